@@ -0,0 +1,39 @@
+// Package auth authenticates the calls of the wasm plugins to the control-planes with a bearer token.
+package auth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ReadToken reads the bearer token from the given file (e.g. a mounted secret).
+// An empty path disables authentication.
+func ReadToken(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Authenticate rejects calls that do not carry the expected bearer token with 401.
+// If no token is configured, all calls are allowed.
+func Authenticate(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				log.Printf("Rejecting unauthenticated call to %s from %s", r.URL.Path, r.RemoteAddr)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hostActivity is reported periodically by the wasm service plugin of every gateway
+type hostActivity struct {
+	Host string `json:"host"`
+	// Requests is the number of requests since the last report
+	Requests int `json:"requests"`
+	// LastSeen is the unix timestamp of the last request
+	LastSeen int64 `json:"last-seen"`
+}
+
+// RouteActivity is the traffic of a route within the sliding window
+type RouteActivity struct {
+	Route    string    `json:"route"`
+	Requests int       `json:"requests"`
+	LastSeen time.Time `json:"last-seen"`
+}
+
+type activitySample struct {
+	time     time.Time
+	requests int
+}
+
+type routeActivity struct {
+	lastSeen time.Time
+	samples  []activitySample
+}
+
+// activityTracker keeps a sliding window of the traffic per route
+type activityTracker struct {
+	window time.Duration
+
+	mux    sync.RWMutex
+	routes map[string]*routeActivity // [namespace/name]
+}
+
+func newActivityTracker(window time.Duration) *activityTracker {
+	return &activityTracker{
+		window: window,
+		routes: make(map[string]*routeActivity),
+	}
+}
+
+func (t *activityTracker) record(route string, requests int, lastSeen time.Time) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	ra, has := t.routes[route]
+	if !has {
+		ra = &routeActivity{}
+		t.routes[route] = ra
+	}
+	if lastSeen.After(ra.lastSeen) {
+		ra.lastSeen = lastSeen
+	}
+	now := time.Now()
+	if requests > 0 {
+		ra.samples = append(ra.samples, activitySample{time: now, requests: requests})
+	}
+	ra.prune(now.Add(-t.window))
+}
+
+func (t *activityTracker) remove(route string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	delete(t.routes, route)
+}
+
+// get returns the activity of the route within the sliding window
+func (t *activityTracker) get(route string) (RouteActivity, bool) {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	ra, has := t.routes[route]
+	if !has {
+		return RouteActivity{Route: route}, false
+	}
+	return ra.activity(route, time.Now().Add(-t.window)), true
+}
+
+func (t *activityTracker) list() []RouteActivity {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	since := time.Now().Add(-t.window)
+	activities := make([]RouteActivity, 0, len(t.routes))
+	for route, ra := range t.routes {
+		activities = append(activities, ra.activity(route, since))
+	}
+	return activities
+}
+
+func (ra *routeActivity) prune(since time.Time) {
+	i := 0
+	for i < len(ra.samples) && ra.samples[i].time.Before(since) {
+		i++
+	}
+	ra.samples = ra.samples[i:]
+}
+
+func (ra *routeActivity) activity(route string, since time.Time) RouteActivity {
+	a := RouteActivity{Route: route, LastSeen: ra.lastSeen}
+	for _, s := range ra.samples {
+		if !s.time.Before(since) {
+			a.Requests += s.requests
+		}
+	}
+	return a
+}
+
+// reportActivity receives the traffic per host from the gateways and records it for the routes the requests were routed to
+func (c *RequestBufferController) reportActivity(w http.ResponseWriter, r *http.Request) {
+	var activities []hostActivity
+	if err := json.NewDecoder(r.Body).Decode(&activities); err != nil {
+		log.Printf("failed to parse activity report: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, a := range activities {
+		for _, rt := range c.routesOfMostSpecificHostname(a.Host) {
+			c.activity.record(rt.key(), a.Requests, time.Unix(a.LastSeen, 0))
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// getActivity returns the traffic of all routes, or of a single route with ?route=kind/namespace/name
+func (c *RequestBufferController) getActivity(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+	if route := r.URL.Query().Get("route"); route != "" {
+		a, has := c.activity.get(route)
+		if !has {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		result = a
+	} else {
+		result = c.activity.list()
+	}
+
+	jsonStr, err := json.Marshal(result)
+	if err != nil {
+		log.Println("failed to marshal activity, err: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(jsonStr)
+	if err != nil {
+		log.Printf("failed to write to output stream, err: %v\n", err)
+	}
+}
+
+// activityHandler serves GET and POST on /v1/activity
+func (c *RequestBufferController) activityHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.getActivity(w, r)
+	case http.MethodPost:
+		// the leader decides about scaling to zero, so it needs the activity of all gateways
+		if c.forwardToLeader(w, r) {
+			return
+		}
+		c.reportActivity(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
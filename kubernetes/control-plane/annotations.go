@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	annotationPrefix = "request-buffer.io/"
+
+	// minReplicasAnnotation is the minimum number of replicas to scale to on wake-up
+	minReplicasAnnotation = annotationPrefix + "min-replicas"
+	// maxReplicasAnnotation is the maximum number of replicas to scale to on wake-up
+	maxReplicasAnnotation = annotationPrefix + "max-replicas"
+	// requestsPerReplicaAnnotation overrides the --requests-per-replica target
+	requestsPerReplicaAnnotation = annotationPrefix + "requests-per-replica"
+	// idleTimeoutAnnotation enables scale-to-zero after the route did not receive traffic for the duration
+	idleTimeoutAnnotation = annotationPrefix + "idle-timeout"
+	// minUpTimeAnnotation overrides the --min-up-time stabilisation window before scaling to zero again
+	minUpTimeAnnotation = annotationPrefix + "min-up-time"
+	// wakeReplicasAnnotation is the number of replicas to restore on wake-up
+	wakeReplicasAnnotation = annotationPrefix + "wake-replicas"
+	// previousReplicasAnnotation is set by the control-plane on workloads that are scaled to zero
+	previousReplicasAnnotation = annotationPrefix + "previous-replicas"
+	// scaleTargetAnnotation on a Service explicitly sets the workload to scale as <group>/<kind>/<name>
+	scaleTargetAnnotation = annotationPrefix + "scale-target"
+	// minReadyEndpointsAnnotation is the number (e.g. "2") or percentage of desired replicas (e.g. "50%")
+	// of ready endpoints before buffered requests are released to a backend
+	minReadyEndpointsAnnotation = annotationPrefix + "min-ready-endpoints"
+	// readinessPolicyAnnotation controls when buffering of a route ends: all (default), any or per-rule
+	readinessPolicyAnnotation = annotationPrefix + "readiness-policy"
+	// enabledAnnotation opts a route in ("true", required with --opt-in) or out ("false") of buffering
+	enabledAnnotation = annotationPrefix + "enabled"
+)
+
+// int32Annotation returns the value of a positive integer annotation, or def if it is not set.
+func int32Annotation(obj metav1.Object, key string, def int32) (int32, error) {
+	v, has := obj.GetAnnotations()[key]
+	if !has {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || i < 0 {
+		return def, fmt.Errorf("invalid value %q for annotation %s on %s/%s", v, key, obj.GetNamespace(), obj.GetName())
+	}
+	return int32(i), nil
+}
+
+// durationAnnotation returns the value of the first object that has the duration annotation set.
+func durationAnnotation(key string, objs ...metav1.Object) (time.Duration, bool, error) {
+	for _, obj := range objs {
+		v, has := obj.GetAnnotations()[key]
+		if !has {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid value %q for annotation %s on %s/%s", v, key, obj.GetNamespace(), obj.GetName())
+		}
+		return d, true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// serviceBackendRef is a backendRef of a route to a Service with the Gateway API defaults applied
+type serviceBackendRef struct {
+	rule      int
+	namespace string
+	name      string
+	port      *gwapiv1.PortNumber
+	// portName references the service port by name instead of the port number, e.g. by an Ingress
+	portName *string
+	weight   int32
+}
+
+func (r serviceBackendRef) String() string {
+	return r.namespace + splitter + r.name
+}
+
+// serviceBackendRefs returns all backendRefs (per rule) of the route to Services. Group and Kind default to the core group and Service,
+// the namespace defaults to the namespace of the route. References to other namespaces are only returned,
+// if a ReferenceGrant in the target namespace allows them.
+func (c *RequestBufferController) serviceBackendRefs(kind string, obj metav1.Object, backendRefs [][]gwapiv1.BackendRef) []serviceBackendRef {
+	var refs []serviceBackendRef
+	for i, rule := range backendRefs {
+		for _, ref := range rule {
+			if !isServiceRef(ref.BackendObjectReference) {
+				continue
+			}
+
+			sr := serviceBackendRef{
+				rule:      i,
+				namespace: obj.GetNamespace(),
+				name:      string(ref.Name),
+				port:      ref.Port,
+				weight:    1,
+			}
+			if ref.Namespace != nil && *ref.Namespace != "" {
+				sr.namespace = string(*ref.Namespace)
+			}
+			if ref.Weight != nil {
+				sr.weight = *ref.Weight
+			}
+
+			if sr.namespace != obj.GetNamespace() && !c.isReferenceGranted(kind, obj.GetNamespace(), sr.namespace, sr.name) {
+				log.Printf("%s references Service %s without a ReferenceGrant, ignoring it", routeKey(kind, obj), sr)
+				continue
+			}
+			refs = append(refs, sr)
+		}
+	}
+	return refs
+}
+
+// isServiceRef returns true if the reference points to a core Service, nil fields are defaulted as defined by the Gateway API
+func isServiceRef(ref gwapiv1.BackendObjectReference) bool {
+	if ref.Group != nil && *ref.Group != "" && *ref.Group != "core" {
+		return false
+	}
+	return ref.Kind == nil || *ref.Kind == "Service"
+}
+
+// isReferenceGranted returns true if a ReferenceGrant in the namespace of the Service allows routes of the kind in fromNamespace to reference it
+func (c *RequestBufferController) isReferenceGranted(kind, fromNamespace, namespace, serviceName string) bool {
+	grants, err := c.referenceGrantInformer.Lister().ReferenceGrants(namespace).List(labels.Everything())
+	if err != nil {
+		log.Printf("Failed to list ReferenceGrants in namespace: %s, %v", namespace, err)
+		return false
+	}
+
+	for _, grant := range grants {
+		fromAllowed := false
+		for _, from := range grant.Spec.From {
+			if from.Group == gwapiv1.GroupName && string(from.Kind) == kind && string(from.Namespace) == fromNamespace {
+				fromAllowed = true
+				break
+			}
+		}
+		if !fromAllowed {
+			continue
+		}
+		for _, to := range grant.Spec.To {
+			if (to.Group == "" || to.Group == "core") && to.Kind == "Service" && (to.Name == nil || string(*to.Name) == serviceName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *RequestBufferController) referenceGrantAdd(obj interface{}) {
+	c.resyncRoutes()
+}
+
+func (c *RequestBufferController) referenceGrantUpdate(old, new interface{}) {
+	c.resyncRoutes()
+}
+
+func (c *RequestBufferController) referenceGrantDelete(obj interface{}) {
+	c.resyncRoutes()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// demand describes the requests the gateway is currently holding for a host
+type demand struct {
+	// pending is the number of buffered requests, gateway-wide
+	pending int
+	// rate is the arrival rate of buffered requests per second
+	rate float64
+}
+
+func parseDemand(pending, rate string) (demand, error) {
+	d := demand{}
+	var err error
+	if pending != "" {
+		if d.pending, err = strconv.Atoi(pending); err != nil {
+			return d, err
+		}
+	}
+	if rate != "" {
+		if d.rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// desiredReplicas calculates the initial replica count for the demand, using the requests-per-replica target
+// bounded by the min and max replicas. All of them can be overridden by annotations on the object.
+func (c *RequestBufferController) desiredReplicas(obj metav1.Object, d demand) int32 {
+	requestsPerReplica, err := int32Annotation(obj, requestsPerReplicaAnnotation, c.options.requestsPerReplica)
+	if err != nil {
+		log.Println(err)
+	}
+	minReplicas, err := int32Annotation(obj, minReplicasAnnotation, 1)
+	if err != nil {
+		log.Println(err)
+	}
+	maxReplicas, err := int32Annotation(obj, maxReplicasAnnotation, c.options.maxReplicas)
+	if err != nil {
+		log.Println(err)
+	}
+
+	replicas := minReplicas
+	if requestsPerReplica > 0 {
+		load := math.Max(float64(d.pending), d.rate)
+		replicas = int32(math.Min(math.Ceil(load/float64(requestsPerReplica)), float64(maxReplicas)))
+	}
+	if replicas < minReplicas {
+		replicas = minReplicas
+	}
+	if replicas > maxReplicas {
+		replicas = maxReplicas
+	}
+	if replicas < 1 {
+		// we always need at least one replica to serve the buffered requests
+		replicas = 1
+	}
+	return replicas
+}
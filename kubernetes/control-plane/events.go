@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	gwscheme "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/scheme"
+)
+
+// eventComponent is the source of the Events of the control-plane
+const eventComponent = "request-buffer-control-plane"
+
+// Reasons of the Events on routes and scale targets
+const (
+	reasonScaleUpStarted   = "ScaleUpStarted"
+	reasonScaleUpSucceeded = "ScaleUpSucceeded"
+	reasonScaleUpFailed    = "ScaleUpFailed"
+	reasonBufferReleased   = "BufferReleased"
+)
+
+// newEventRecorder creates a recorder for Events on routes and scale targets.
+// The scheme resolves the kinds of typed objects of the informers, which have no TypeMeta.
+func newEventRecorder(k8sClient kubernetes.Interface) (record.EventRecorder, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := gwscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme, corev1.EventSource{Component: eventComponent}), nil
+}
+
+// routeEvent records an Event on the resource of the route
+func (c *RequestBufferController) routeEvent(r *route, eventType, reason, messageFmt string, args ...interface{}) {
+	obj, ok := r.obj.(runtime.Object)
+	if !ok {
+		log.Printf("Failed to record %s on %s, it is not a runtime.Object", reason, r)
+		return
+	}
+	c.recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// scaleTargetEvent records an Event on the workload of the scale target
+func (c *RequestBufferController) scaleTargetEvent(t scaleTarget, eventType, reason, messageFmt string, args ...interface{}) {
+	c.recorder.Eventf(t.obj, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// routeParent is a Gateway the route is attached to with the parentRef of the route
+type routeParent struct {
+	gateway *gwapiv1.Gateway
+	ref     gwapiv1.ParentReference
+}
+
+func (p routeParent) String() string {
+	return p.gateway.Namespace + splitter + p.gateway.Name
+}
+
+// gatewayAPIRoute resolves a route of the Gateway API with the hostnames and backendRefs (per rule) of the route
+func (c *RequestBufferController) gatewayAPIRoute(kind string, obj metav1.Object, spec gwapiv1.CommonRouteSpec, status gwapiv1.RouteStatus,
+	hostnames []gwapiv1.Hostname, backendRefs [][]gwapiv1.BackendRef) *route {
+	parents, unresolved := c.routeParents(kind, obj, spec.ParentRefs, status)
+
+	r := &route{
+		kind:      kind,
+		obj:       obj,
+		hostnames: routeHostnames(parents, hostnames),
+		backends:  c.serviceBackendRefs(kind, obj, backendRefs),
+	}
+	if len(parents) == 0 && len(unresolved) > 0 {
+		// e.g. the Gateway is not synced yet or in a namespace that is not watched, we do not know its listeners
+		r.reason = fmt.Sprintf("no parent resolved (%s), using the hostnames of the route", strings.Join(unresolved, ", "))
+		for _, h := range hostnames {
+			r.hostnames = append(r.hostnames, string(h))
+		}
+	}
+	for _, p := range parents {
+		if !slices.Contains(r.gateways, p.String()) {
+			r.gateways = append(r.gateways, p.String())
+		}
+	}
+	return r
+}
+
+// routeParents returns all existing Gateways in the parentRefs of the route and the parentRefs that could not be resolved.
+// Parents the route was explicitly not accepted by are ignored. A parent without status is still used,
+// as its controller might not have processed the route yet.
+func (c *RequestBufferController) routeParents(kind string, obj metav1.Object, parentRefs []gwapiv1.ParentReference, status gwapiv1.RouteStatus) ([]routeParent, []string) {
+	var parents []routeParent
+	var unresolved []string
+	for _, ref := range parentRefs {
+		if !isGatewayRef(ref) {
+			unresolved = append(unresolved, fmt.Sprintf("%s %s is not a Gateway", valueOr(ref.Kind, "Gateway"), ref.Name))
+			continue
+		}
+		namespace := obj.GetNamespace()
+		if ref.Namespace != nil && *ref.Namespace != "" {
+			namespace = string(*ref.Namespace)
+		}
+
+		gateway, err := c.gatewayInformer.Lister().Gateways(namespace).Get(string(ref.Name))
+		if err != nil {
+			log.Printf("Failed to get Gateway %s/%s of %s: %v", namespace, ref.Name, routeKey(kind, obj), err)
+			unresolved = append(unresolved, fmt.Sprintf("Gateway %s/%s not found", namespace, ref.Name))
+			continue
+		}
+		if isRejectedParent(obj.GetNamespace(), status, ref) {
+			log.Printf("%s is not accepted by Gateway %s/%s, ignoring it", routeKey(kind, obj), namespace, ref.Name)
+			continue
+		}
+		parents = append(parents, routeParent{gateway: gateway, ref: ref})
+	}
+	return parents, unresolved
+}
+
+// isGatewayRef returns true if the parentRef points to a Gateway, nil fields are defaulted as defined by the Gateway API
+func isGatewayRef(ref gwapiv1.ParentReference) bool {
+	if ref.Group != nil && *ref.Group != gwapiv1.GroupName {
+		return false
+	}
+	return ref.Kind == nil || *ref.Kind == "Gateway"
+}
+
+// isRejectedParent returns true if the status of the route reports that the parent did not accept it
+func isRejectedParent(namespace string, status gwapiv1.RouteStatus, ref gwapiv1.ParentReference) bool {
+	for _, ps := range status.Parents {
+		if !sameParentRef(namespace, ps.ParentRef, ref) {
+			continue
+		}
+		accepted := meta.FindStatusCondition(ps.Conditions, string(gwapiv1.RouteConditionAccepted))
+		if accepted != nil && accepted.Status != metav1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// sameParentRef compares two parentRefs of a route in the namespace
+func sameParentRef(namespace string, a, b gwapiv1.ParentReference) bool {
+	return a.Name == b.Name &&
+		valueOr(a.Namespace, gwapiv1.Namespace(namespace)) == valueOr(b.Namespace, gwapiv1.Namespace(namespace)) &&
+		valueOr(a.SectionName, "") == valueOr(b.SectionName, "") &&
+		valueOr(a.Port, 0) == valueOr(b.Port, 0)
+}
+
+func valueOr[T ~string | ~int32](v *T, def T) T {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func (c *RequestBufferController) gatewayAdd(obj interface{}) {
+	c.resyncRoutes()
+}
+
+func (c *RequestBufferController) gatewayUpdate(old, new interface{}) {
+	c.resyncRoutes()
+}
+
+func (c *RequestBufferController) gatewayDelete(obj interface{}) {
+	c.resyncRoutes()
+}
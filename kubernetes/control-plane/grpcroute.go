@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gwapiv1a2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+const grpcRouteKind = "GRPCRoute"
+
+// newGRPCRouteSource watches GRPCRoutes, they are only available in the experimental channel of the Gateway API
+func (c *RequestBufferController) newGRPCRouteSource() (routeSource, error) {
+	_, err := c.restMapper.RESTMapping(schema.GroupKind{Group: gwapiv1a2.GroupName, Kind: grpcRouteKind}, gwapiv1a2.GroupVersion.Version)
+	if err != nil {
+		return routeSource{}, err
+	}
+	return routeSource{
+		kind:     grpcRouteKind,
+		informer: c.routeInformers.gw.Gateway().V1alpha2().GRPCRoutes().Informer(),
+		toRoute:  c.grpcRoute,
+	}, nil
+}
+
+func (c *RequestBufferController) grpcRoute(obj interface{}) (*route, bool) {
+	rt, ok := obj.(*gwapiv1a2.GRPCRoute)
+	if !ok {
+		log.Printf("object is not a GRPCRoute: %v", obj)
+		return nil, false
+	}
+
+	backendRefs := make([][]gwapiv1.BackendRef, len(rt.Spec.Rules))
+	for i, rule := range rt.Spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			backendRefs[i] = append(backendRefs[i], ref.BackendRef)
+		}
+	}
+	r := c.gatewayAPIRoute(grpcRouteKind, rt, rt.Spec.CommonRouteSpec, rt.Status.RouteStatus, rt.Spec.Hostnames, backendRefs)
+	r.methods = grpcMethods(rt)
+	return r, true
+}
+
+// grpcMethods returns the gRPC services and methods the rules of the route match as paths, /<service>/ for all methods of a service.
+// If any rule matches requests without an exact service, e.g. by headers or regular expressions, the route matches all requests and nil is returned.
+func grpcMethods(rt *gwapiv1a2.GRPCRoute) []string {
+	var methods []string
+	for _, rule := range rt.Spec.Rules {
+		if len(rule.Matches) == 0 {
+			return nil
+		}
+		for _, m := range rule.Matches {
+			if m.Method == nil || m.Method.Service == nil {
+				return nil
+			}
+			if m.Method.Type != nil && *m.Method.Type != gwapiv1a2.GRPCMethodMatchExact {
+				return nil
+			}
+
+			path := "/" + *m.Method.Service + "/"
+			if m.Method.Method != nil {
+				path += *m.Method.Method
+			}
+			if !slices.Contains(methods, path) {
+				methods = append(methods, path)
+			}
+		}
+	}
+	return methods
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// wildcardHostname matches all hosts, it is used when neither the listener nor the route specify a hostname
+const wildcardHostname = "*"
+
+// readyHostPrefix marks hostnames of ready routes published to the filters, see shadowingHostnames
+const readyHostPrefix = "!"
+
+// routeHostnames returns the hostnames Envoy routes to the route. These are the intersections of the hostnames of the route
+// with the hostnames of all listeners of the Gateways it is attached to, as defined by the Gateway API.
+func routeHostnames(parents []routeParent, routeHostnames []gwapiv1.Hostname) []string {
+	var hostnames []string
+	for _, p := range parents {
+		for _, l := range parentListeners(p) {
+			for _, h := range intersectHostnames(l.Hostname, routeHostnames) {
+				if !slices.Contains(hostnames, h) {
+					hostnames = append(hostnames, h)
+				}
+			}
+		}
+	}
+	return hostnames
+}
+
+// parentListeners returns the listeners of the Gateway selected by the sectionName and port of the parentRef
+func parentListeners(p routeParent) []gwapiv1.Listener {
+	var listeners []gwapiv1.Listener
+	for _, l := range p.gateway.Spec.Listeners {
+		if p.ref.SectionName != nil && *p.ref.SectionName != l.Name {
+			continue
+		}
+		if p.ref.Port != nil && *p.ref.Port != l.Port {
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// intersectHostnames returns the hostnames that match both the listener and the route.
+// The more specific hostname of a match is returned, e.g. foo.example.com for the listener *.example.com and the route foo.example.com.
+func intersectHostnames(listener *gwapiv1.Hostname, route []gwapiv1.Hostname) []string {
+	if len(route) == 0 {
+		if listener == nil || *listener == "" {
+			return []string{wildcardHostname}
+		}
+		return []string{string(*listener)}
+	}
+
+	var hostnames []string
+	for _, r := range route {
+		switch {
+		case listener == nil || *listener == "":
+			hostnames = append(hostnames, string(r))
+		case hostnameMatches(string(*listener), string(r)):
+			hostnames = append(hostnames, string(r))
+		case hostnameMatches(string(r), string(*listener)):
+			hostnames = append(hostnames, string(*listener))
+		}
+	}
+	return hostnames
+}
+
+// hostnameMatches returns true if the hostname is matched by the pattern. A pattern with a leading
+// wildcard label matches all hostnames with the suffix, e.g. *.example.com matches foo.bar.example.com but not example.com.
+// A wildcard hostname matches a pattern only if its suffix does, e.g. *.foo.example.com matches *.example.com.
+func hostnameMatches(pattern, hostname string) bool {
+	if pattern == wildcardHostname || pattern == hostname {
+		return true
+	}
+	suffix, isWildcard := strings.CutPrefix(pattern, "*")
+	if !isWildcard {
+		return false
+	}
+	hostname = strings.TrimPrefix(hostname, "*")
+	return strings.HasSuffix(hostname, suffix) && len(hostname) > len(suffix)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const httpRouteKind = "HTTPRoute"
+
+func (c *RequestBufferController) newHTTPRouteSource() (routeSource, error) {
+	_, err := c.restMapper.RESTMapping(schema.GroupKind{Group: gwapiv1.GroupName, Kind: httpRouteKind}, gwapiv1.GroupVersion.Version)
+	if err != nil {
+		return routeSource{}, err
+	}
+	return routeSource{
+		kind:     httpRouteKind,
+		informer: c.routeInformers.gw.Gateway().V1().HTTPRoutes().Informer(),
+		toRoute:  c.httpRoute,
+	}, nil
+}
+
+func (c *RequestBufferController) httpRoute(obj interface{}) (*route, bool) {
+	rt, ok := obj.(*gwapiv1.HTTPRoute)
+	if !ok {
+		log.Printf("object is not a HTTPRoute: %v", obj)
+		return nil, false
+	}
+
+	backendRefs := make([][]gwapiv1.BackendRef, len(rt.Spec.Rules))
+	for i, rule := range rt.Spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			backendRefs[i] = append(backendRefs[i], ref.BackendRef)
+		}
+	}
+	return c.gatewayAPIRoute(httpRouteKind, rt, rt.Spec.CommonRouteSpec, rt.Status.RouteStatus, rt.Spec.Hostnames, backendRefs), true
+}
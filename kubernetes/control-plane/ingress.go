@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const ingressKind = "Ingress"
+
+const (
+	// ingressClassAnnotation is the deprecated annotation to set the class of an Ingress
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// defaultIngressClassAnnotation marks the IngressClass used for Ingresses without a class
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+func (c *RequestBufferController) newIngressSource() (routeSource, error) {
+	_, err := c.restMapper.RESTMapping(schema.GroupKind{Group: networkingv1.GroupName, Kind: ingressKind}, networkingv1.SchemeGroupVersion.Version)
+	if err != nil {
+		return routeSource{}, err
+	}
+	c.ingressClassInformer = c.k8sInformerFactory.Networking().V1().IngressClasses()
+	return routeSource{
+		kind:         ingressKind,
+		informer:     c.routeInformers.k8s.Networking().V1().Ingresses().Informer(),
+		dependencies: []cache.SharedIndexInformer{c.ingressClassInformer.Informer()},
+		toRoute:      c.ingress,
+	}, nil
+}
+
+// ingress resolves an Ingress of one of the configured ingress classes. Every rule is a rule of the route,
+// the defaultBackend is an additional rule that serves all hosts.
+func (c *RequestBufferController) ingress(obj interface{}) (*route, bool) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		log.Printf("object is not an Ingress: %v", obj)
+		return nil, false
+	}
+	if !c.isServedIngress(ing) {
+		return nil, false
+	}
+
+	r := &route{
+		kind: ingressKind,
+		obj:  ing,
+	}
+	addHostname := func(h string) {
+		if h == "" {
+			h = wildcardHostname
+		}
+		if !slices.Contains(r.hostnames, h) {
+			r.hostnames = append(r.hostnames, h)
+		}
+	}
+	addBackend := func(rule int, backend networkingv1.IngressBackend) {
+		if backend.Service == nil {
+			// resource backends are not Services
+			return
+		}
+		ref := serviceBackendRef{
+			rule:      rule,
+			namespace: ing.Namespace,
+			name:      backend.Service.Name,
+			weight:    1,
+		}
+		if backend.Service.Port.Number != 0 {
+			port := gwapiv1.PortNumber(backend.Service.Port.Number)
+			ref.port = &port
+		} else if backend.Service.Port.Name != "" {
+			portName := backend.Service.Port.Name
+			ref.portName = &portName
+		}
+		r.backends = append(r.backends, ref)
+	}
+
+	for i, rule := range ing.Spec.Rules {
+		addHostname(rule.Host)
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			addBackend(i, path.Backend)
+		}
+	}
+	if ing.Spec.DefaultBackend != nil {
+		addHostname(wildcardHostname)
+		addBackend(len(ing.Spec.Rules), *ing.Spec.DefaultBackend)
+	}
+	return r, true
+}
+
+// isServedIngress returns true if the Ingress has one of the configured ingress classes.
+// The class is set by spec.ingressClassName, the deprecated annotation or the default IngressClass of the cluster.
+func (c *RequestBufferController) isServedIngress(ing *networkingv1.Ingress) bool {
+	class := ""
+	if ing.Spec.IngressClassName != nil {
+		class = *ing.Spec.IngressClassName
+	} else if v, has := ing.Annotations[ingressClassAnnotation]; has {
+		class = v
+	} else {
+		class = c.defaultIngressClass()
+	}
+	return slices.Contains(c.options.ingressClasses, class)
+}
+
+// defaultIngressClass returns the name of the IngressClass marked as default, empty if there is none
+func (c *RequestBufferController) defaultIngressClass() string {
+	classes, err := c.ingressClassInformer.Lister().List(labels.Everything())
+	if err != nil {
+		log.Printf("Failed to list IngressClasses: %v", err)
+		return ""
+	}
+	for _, ic := range classes {
+		if ic.Annotations[defaultIngressClassAnnotation] == "true" {
+			return ic.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// forwardedHeader marks requests forwarded to the leader, they are never forwarded again
+const forwardedHeader = "x-request-buffer-forwarded"
+
+// leaderState is the result of the leader election. Without leader election, every replica is the leader.
+type leaderState struct {
+	mux      sync.RWMutex
+	isLeader bool
+	// leader is the identity, which is the advertise address, of the current leader
+	leader string
+	// since is the time this replica became the leader. Activity is only reported to the leader,
+	// so it does not know about traffic before.
+	since time.Time
+}
+
+func (s *leaderState) get() (bool, string) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.isLeader, s.leader
+}
+
+func (s *leaderState) set(isLeader bool, leader string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if isLeader && !s.isLeader {
+		s.since = time.Now()
+	}
+	s.isLeader = isLeader
+	s.leader = leader
+}
+
+func (s *leaderState) leadingSince() time.Time {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.since
+}
+
+// isLeader returns true if this replica is allowed to scale workloads
+func (c *RequestBufferController) isLeader() bool {
+	isLeader, _ := c.leader.get()
+	return isLeader
+}
+
+// defaultAdvertiseAddress is the address of the pod, under which other replicas forward requests to the leader
+func defaultAdvertiseAddress() string {
+	host := os.Getenv("POD_IP")
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(httpPort))
+}
+
+// defaultLeaderElectionNamespace is the namespace of the pod, the Lease is created next to the control plane
+func defaultLeaderElectionNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+// runLeaderElection competes for the lease until stopCh is closed. The identity of every replica is its advertise address.
+func (c *RequestBufferController) runLeaderElection(stopCh <-chan struct{}) {
+	identity := c.options.advertiseAddress
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: c.options.leaderElectionNamespace,
+			Name:      c.options.leaderElectionID,
+		},
+		Client: c.k8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+	config := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				log.Printf("%s became the leader, starting to scale workloads", identity)
+				c.leader.set(true, identity)
+				// the status of routes was not written while we were a follower
+				c.resyncRoutes()
+			},
+			OnStoppedLeading: func() {
+				log.Printf("%s is no longer the leader, stopping to scale workloads", identity)
+				c.leader.set(false, "")
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Printf("%s is the leader, forwarding pokes to it", leader)
+					c.leader.set(false, leader)
+				}
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	// RunOrDie returns when the lease is lost, we keep competing for it
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		leaderelection.RunOrDie(ctx, config)
+	}, time.Second)
+}
+
+// forwardToLeader forwards a request that changes the scale of workloads to the leader.
+// It returns false if this replica is the leader and has to handle the request itself.
+func (c *RequestBufferController) forwardToLeader(w http.ResponseWriter, r *http.Request) bool {
+	isLeader, leader := c.leader.get()
+	if isLeader {
+		return false
+	}
+	if leader == "" || r.Header.Get(forwardedHeader) != "" {
+		log.Printf("No leader to forward %s to", r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = leader
+			req.Header.Set(forwardedHeader, "true")
+		},
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
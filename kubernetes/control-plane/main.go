@@ -8,28 +8,43 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/util/workqueue"
 	gwapi "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 	gwinformers "sigs.k8s.io/gateway-api/pkg/client/informers/externalversions"
 
+	"github.com/retocode/envoy-request-buffer/auth"
+
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/client-go/tools/cache"
-	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
 	"sigs.k8s.io/gateway-api/pkg/client/informers/externalversions/apis/v1"
+	"sigs.k8s.io/gateway-api/pkg/client/informers/externalversions/apis/v1beta1"
 
 	coreinformers "k8s.io/client-go/informers/core/v1"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
+	networkinginformers "k8s.io/client-go/informers/networking/v1"
 )
 
 const (
@@ -38,30 +53,131 @@ const (
 )
 
 type RequestBufferController struct {
-	k8sClient *kubernetes.Clientset
-
-	k8sInformerFactory informers.SharedInformerFactory
-	gwInformerFactory  gwinformers.SharedInformerFactory
-
-	endpointsInformer coreinformers.EndpointsInformer
-	httpRouteInformer v1.HTTPRouteInformer
+	k8sClient     *kubernetes.Clientset
+	gwClient      gwapi.Interface
+	dynamicClient dynamic.Interface
+	scaleClient   scale.ScalesGetter
+	restMapper    meta.RESTMapper
+	recorder      record.EventRecorder
+
+	k8sInformerFactory     informers.SharedInformerFactory
+	gwInformerFactory      gwinformers.SharedInformerFactory
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	routeInformers         routeInformerFactories
+
+	endpointSliceInformer  discoveryinformers.EndpointSliceInformer
+	serviceInformer        coreinformers.ServiceInformer
+	gatewayInformer        v1.GatewayInformer
+	referenceGrantInformer v1beta1.ReferenceGrantInformer
+	ingressClassInformer   networkinginformers.IngressClassInformer
+	scaleTargetInformers   map[schema.GroupKind]scaleTargetInformer
+	routeSources           []routeSource
+	// routes are the resolved routes of all route sources, indexed by hostname and backend Service
+	routes cache.Indexer
+	// queue holds the keys of routes to reconcile
+	queue workqueue.RateLimitingInterface
+
+	options  controllerOptions
+	activity *activityTracker
+	scaleUps *scaleUpTracker
+	leader   *leaderState
 
 	mux                 sync.RWMutex
-	scaledToZeroTargets map[string][]string // [service-name][]domains
+	scaledToZeroTargets map[string][]string  // [service-name][]domains
+	scaledUpAt          map[string]time.Time // [route-name]time of the last scale-up
+	routeStates         map[string]RouteState
+}
+
+type controllerOptions struct {
+	// requestsPerReplica is the target of buffered requests per replica when scaling up
+	requestsPerReplica int32
+	// maxReplicas is the default upper bound of replicas when scaling up
+	maxReplicas int32
+	// activityWindow is the duration of the sliding window of the traffic activity per route
+	activityWindow time.Duration
+	// minUpTime is the default stabilisation window after a scale-up before scaling to zero again
+	minUpTime time.Duration
+	// scaleTargetKinds are the kinds of workloads that are matched to Services by their selector
+	scaleTargetKinds []schema.GroupKind
+	// routeSources are the kinds of resources that route requests to Services
+	routeSources []string
+	// ingressClasses are the classes of Ingresses served by our Envoy
+	ingressClasses []string
+	// workers is the number of routes reconciled in parallel
+	workers int
+	// scaleUpCooldown is the time after a scale-up of a route before pokes start a new one
+	scaleUpCooldown time.Duration
+	// leaderElection enables running multiple replicas, only the leader scales workloads
+	leaderElection bool
+	// leaderElectionNamespace and leaderElectionID are the namespace and name of the Lease of the leader election
+	leaderElectionNamespace string
+	leaderElectionID        string
+	// advertiseAddress is the address other replicas forward pokes to, when this replica is the leader
+	advertiseAddress string
+	// namespaces are the namespaces of the watched routes, empty for all namespaces
+	namespaces []string
+	// optIn only buffers routes with the enabled annotation set to "true"
+	optIn bool
 }
 
 func main() {
+	var kubeconfig *string
+	if home := homedir.HomeDir(); home != "" {
+		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+	authTokenFile := flag.String("auth-token-file", "", "(optional) path to a file containing the bearer token the wasm plugins have to send")
+	requestsPerReplica := flag.Int("requests-per-replica", 10, "target of buffered requests per replica when scaling up, can be overridden with the "+requestsPerReplicaAnnotation+" annotation")
+	maxReplicas := flag.Int("max-replicas", 10, "default maximum of replicas when scaling up, can be overridden with the "+maxReplicasAnnotation+" annotation")
+	activityWindow := flag.Duration("activity-window", 15*time.Minute, "duration of the sliding window of the traffic activity per route")
+	minUpTime := flag.Duration("min-up-time", 5*time.Minute, "minimum time workloads stay up after a scale-up before they are scaled to zero again, can be overridden with the "+minUpTimeAnnotation+" annotation")
+	scaleTargetKinds := flag.String("scale-target-kinds", "apps/Deployment,apps/StatefulSet", "comma separated list of <group>/<kind> of workloads with a /scale subresource that are matched to Services by their selector")
+	routeSources := flag.String("route-sources", httpRouteKind+","+grpcRouteKind, "comma separated list of the kinds of resources that route requests to Services, supported are "+strings.Join(routeSourceKinds, ", "))
+	ingressClasses := flag.String("ingress-classes", "istio", "comma separated list of the classes of Ingresses served by our Envoy, when "+ingressKind+" is a route source")
+	scaleUpCooldown := flag.Duration("scale-up-cooldown", 5*time.Second, "time after a scale-up of a route before pokes start a new scale-up")
+	leaderElection := flag.Bool("leader-elect", false, "run leader election to support multiple replicas, only the leader scales workloads")
+	leaderElectionNamespace := flag.String("leader-elect-namespace", defaultLeaderElectionNamespace(), "namespace of the Lease of the leader election")
+	leaderElectionID := flag.String("leader-elect-id", "request-buffer-control-plane", "name of the Lease of the leader election")
+	advertiseAddress := flag.String("advertise-address", defaultAdvertiseAddress(), "address (<host>:<port>) other replicas forward pokes to, when this replica is the leader")
+	workers := flag.Int("workers", 2, "number of routes that are reconciled in parallel")
+	namespaces := flag.String("namespaces", "", "comma separated list of namespaces of the watched routes, all namespaces if empty. With a single namespace, all informers are limited to it")
+	routeSelector := flag.String("route-selector", "", "label selector of the watched routes, all routes if empty")
+	optIn := flag.Bool("opt-in", false, "only buffer routes with the "+enabledAnnotation+": \"true\" annotation, routes can always opt out with \"false\"")
+	flag.Parse()
+
+	authToken, err := auth.ReadToken(*authTokenFile)
+	if err != nil {
+		log.Fatalf("Failed to read auth token: %v", err)
+	}
+	if authToken == "" {
+		log.Println("No auth token configured, the control-plane API is unauthenticated")
+	}
+
+	kinds, err := parseGroupKinds(*scaleTargetKinds)
+	if err != nil {
+		log.Fatalf("Invalid scale target kinds: %v", err)
+	}
+
+	if *workers < 1 {
+		log.Fatalf("Invalid number of workers: %d", *workers)
+	}
+
+	sources, err := parseRouteSources(*routeSources)
+	if err != nil {
+		log.Fatalf("Invalid route sources: %v", err)
+	}
+
+	selector, err := labels.Parse(*routeSelector)
+	if err != nil {
+		log.Fatalf("Invalid route selector: %v", err)
+	}
+	watchedNamespaces := splitList(*namespaces)
+
 	log.Println("Starting kubernetes watchers")
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		log.Println("No in-cluster config found, trying with kubeconfig")
-		var kubeconfig *string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-		} else {
-			kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-		}
-		flag.Parse()
 		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
 		if err != nil {
 			log.Fatalf("Failed to create K8s client: %v", err)
@@ -77,10 +193,54 @@ func main() {
 		log.Fatalf("Failed to create GW-API client: %v", err)
 	}
 
-	k8sInformerFactory := informers.NewSharedInformerFactory(k8sClient, time.Hour*24)
-	gwInformerFactory := gwinformers.NewSharedInformerFactory(gwClient, time.Hour*24)
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to create dynamic K8s client: %v", err)
+	}
 
-	controller, err := newRequestBufferController(k8sClient, k8sInformerFactory, gwInformerFactory)
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(k8sClient.Discovery()))
+	scaleClient, err := scale.NewForConfig(config, restMapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(k8sClient.Discovery()))
+	if err != nil {
+		log.Fatalf("Failed to create K8s scale client: %v", err)
+	}
+
+	namespace := informerNamespace(watchedNamespaces)
+	k8sInformerFactory := informers.NewSharedInformerFactoryWithOptions(k8sClient, time.Hour*24, informers.WithNamespace(namespace))
+	gwInformerFactory := gwinformers.NewSharedInformerFactoryWithOptions(gwClient, time.Hour*24, gwinformers.WithNamespace(namespace))
+	dynamicInformerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, time.Hour*24, namespace, nil)
+
+	selectRoutes := func(options *metav1.ListOptions) {
+		options.LabelSelector = selector.String()
+	}
+	routeInformers := routeInformerFactories{
+		k8s: informers.NewSharedInformerFactoryWithOptions(k8sClient, time.Hour*24,
+			informers.WithNamespace(namespace), informers.WithTweakListOptions(selectRoutes)),
+		gw: gwinformers.NewSharedInformerFactoryWithOptions(gwClient, time.Hour*24,
+			gwinformers.WithNamespace(namespace), gwinformers.WithTweakListOptions(selectRoutes)),
+		dynamic: dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, time.Hour*24, namespace, selectRoutes),
+	}
+
+	options := controllerOptions{
+		requestsPerReplica: int32(*requestsPerReplica),
+		maxReplicas:        int32(*maxReplicas),
+		activityWindow:     *activityWindow,
+		minUpTime:          *minUpTime,
+		scaleTargetKinds:   kinds,
+		routeSources:       sources,
+		ingressClasses:     splitList(*ingressClasses),
+		workers:            *workers,
+		scaleUpCooldown:    *scaleUpCooldown,
+
+		leaderElection:          *leaderElection,
+		leaderElectionNamespace: *leaderElectionNamespace,
+		leaderElectionID:        *leaderElectionID,
+		advertiseAddress:        *advertiseAddress,
+
+		namespaces: watchedNamespaces,
+		optIn:      *optIn,
+	}
+	controller, err := newRequestBufferController(k8sClient, gwClient, dynamicClient, scaleClient, restMapper,
+		k8sInformerFactory, gwInformerFactory, dynamicInformerFactory, routeInformers, options)
 	if err != nil {
 		log.Fatalf("Error creating controller: %v", err)
 	}
@@ -93,8 +253,11 @@ func main() {
 	}
 
 	// HTTP server to return the state to envoy
-	http.HandleFunc("/", controller.getScaledToZeroClusters)
-	http.HandleFunc("/poke-scale-up", controller.pokeScaleUp)
+	http.HandleFunc("/", auth.Authenticate(authToken, controller.getScaledToZeroClusters))
+	http.HandleFunc("/poke-scale-up", auth.Authenticate(authToken, controller.pokeScaleUp))
+	http.HandleFunc("/v1/state", auth.Authenticate(authToken, controller.getState))
+	http.HandleFunc("/v1/activity", auth.Authenticate(authToken, controller.activityHandler))
+	http.HandleFunc("/v1/scale-ups", auth.Authenticate(authToken, controller.getScaleUps))
 	srv := &http.Server{
 		Addr:         ":" + strconv.Itoa(httpPort),
 		WriteTimeout: 5 * time.Second,
@@ -104,53 +267,124 @@ func main() {
 	log.Fatal(srv.ListenAndServe())
 }
 
-func newRequestBufferController(k8sClient *kubernetes.Clientset, k8sInformerFactory informers.SharedInformerFactory, gwInformerFactory gwinformers.SharedInformerFactory) (*RequestBufferController, error) {
-	endpointsInformer := k8sInformerFactory.Core().V1().Endpoints()
-	httpRouteInformer := gwInformerFactory.Gateway().V1().HTTPRoutes()
+func newRequestBufferController(k8sClient *kubernetes.Clientset, gwClient gwapi.Interface, dynamicClient dynamic.Interface, scaleClient scale.ScalesGetter, restMapper meta.RESTMapper,
+	k8sInformerFactory informers.SharedInformerFactory, gwInformerFactory gwinformers.SharedInformerFactory, dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory,
+	routeInformers routeInformerFactories, options controllerOptions) (*RequestBufferController, error) {
+	endpointSliceInformer := k8sInformerFactory.Discovery().V1().EndpointSlices()
+	serviceInformer := k8sInformerFactory.Core().V1().Services()
+	recorder, err := newEventRecorder(k8sClient)
+	if err != nil {
+		return nil, err
+	}
 
 	c := &RequestBufferController{
-		k8sClient: k8sClient,
-
-		k8sInformerFactory: k8sInformerFactory,
-		gwInformerFactory:  gwInformerFactory,
-
-		endpointsInformer: endpointsInformer,
-		httpRouteInformer: httpRouteInformer,
+		k8sClient:     k8sClient,
+		gwClient:      gwClient,
+		dynamicClient: dynamicClient,
+		scaleClient:   scaleClient,
+		restMapper:    restMapper,
+		recorder:      recorder,
+
+		k8sInformerFactory:     k8sInformerFactory,
+		gwInformerFactory:      gwInformerFactory,
+		dynamicInformerFactory: dynamicInformerFactory,
+		routeInformers:         routeInformers,
+
+		endpointSliceInformer:  endpointSliceInformer,
+		serviceInformer:        serviceInformer,
+		gatewayInformer:        gwInformerFactory.Gateway().V1().Gateways(),
+		referenceGrantInformer: gwInformerFactory.Gateway().V1beta1().ReferenceGrants(),
+		scaleTargetInformers:   newScaleTargetInformers(restMapper, dynamicInformerFactory, options.scaleTargetKinds),
+
+		options:  options,
+		activity: newActivityTracker(options.activityWindow),
+		scaleUps: newScaleUpTracker(options.scaleUpCooldown),
+		// without leader election, we are always the leader
+		leader: &leaderState{isLeader: !options.leaderElection, since: time.Now()},
 
 		scaledToZeroTargets: make(map[string][]string),
+		scaledUpAt:          make(map[string]time.Time),
+		routeStates:         make(map[string]RouteState),
+		routes:              newRouteIndex(),
+		queue:               newRouteQueue(),
+	}
+	c.routeSources = c.newRouteSources(options.routeSources)
+	if len(c.routeSources) == 0 {
+		return nil, fmt.Errorf("none of the route sources %v is available in the cluster", options.routeSources)
+	}
+	err = endpointSliceInformer.Informer().AddIndexers(cache.Indexers{
+		serviceNameIndex: endpointSliceServiceNameIndexFunc,
+	})
+	if err != nil {
+		return nil, err
 	}
-	_, err := endpointsInformer.Informer().AddEventHandler(
+	_, err = endpointSliceInformer.Informer().AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
-			AddFunc:    c.endpointAdd,
-			UpdateFunc: c.endpointUpdate,
-			DeleteFunc: c.endpointDelete,
+			AddFunc:    c.endpointSliceAdd,
+			UpdateFunc: c.endpointSliceUpdate,
+			DeleteFunc: c.endpointSliceDelete,
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
-	_, err = httpRouteInformer.Informer().AddEventHandler(
+	_, err = serviceInformer.Informer().AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
-			AddFunc:    c.routeAdd,
-			UpdateFunc: c.routeUpdate,
-			DeleteFunc: c.routeDelete,
+			AddFunc:    c.serviceAdd,
+			UpdateFunc: c.serviceUpdate,
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
+	if err = c.addScaleTargetEventHandlers(); err != nil {
+		return nil, err
+	}
+	if c.watchesGatewayAPI() {
+		_, err = c.gatewayInformer.Informer().AddEventHandler(
+			cache.ResourceEventHandlerFuncs{
+				AddFunc:    c.gatewayAdd,
+				UpdateFunc: c.gatewayUpdate,
+				DeleteFunc: c.gatewayDelete,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.referenceGrantInformer.Informer().AddEventHandler(
+			cache.ResourceEventHandlerFuncs{
+				AddFunc:    c.referenceGrantAdd,
+				UpdateFunc: c.referenceGrantUpdate,
+				DeleteFunc: c.referenceGrantDelete,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = c.addRouteEventHandlers(); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
 
+// getScaledToZeroClusters returns the hosts of all routes that are scaled to zero.
+// With ?gateway=<namespace>/<name> only routes attached to that Gateway or without Gateways are returned.
 func (c *RequestBufferController) getScaledToZeroClusters(w http.ResponseWriter, r *http.Request) {
+	gateway := r.URL.Query().Get("gateway")
+
 	c.mux.RLock()
 	defer c.mux.RUnlock()
 
 	domains := make([]string, 0, len(c.scaledToZeroTargets))
-	for _, hosts := range c.scaledToZeroTargets {
+	for key, hosts := range c.scaledToZeroTargets {
+		if !c.routeStates[key].isServedBy(gateway) {
+			continue
+		}
 		domains = append(domains, hosts...)
 	}
+	domains = append(domains, c.shadowingHostnames(gateway, domains)...)
 	jsonStr, err := json.Marshal(domains)
 	if err != nil {
 		log.Println("failed to marshal scaledToZeroTargets, err: ", err)
@@ -163,11 +397,72 @@ func (c *RequestBufferController) getScaledToZeroClusters(w http.ResponseWriter,
 	}
 }
 
+// shadowingHostnames returns the hostnames of ready routes that are more specific than the hostname of a scaled to zero host,
+// prefixed with "!". Envoy routes requests to the most specific hostname, so the filter must not buffer their requests.
+// The caller must hold the read lock.
+func (c *RequestBufferController) shadowingHostnames(gateway string, scaledToZeroHosts []string) []string {
+	scaledToZero := make([]string, 0, len(scaledToZeroHosts))
+	for _, h := range scaledToZeroHosts {
+		// hosts limited to gRPC methods have them appended as path
+		hostname, _, _ := strings.Cut(h, "/")
+		scaledToZero = append(scaledToZero, hostname)
+	}
+
+	var shadowing []string
+	for key, state := range c.routeStates {
+		if _, has := c.scaledToZeroTargets[key]; has || !state.Ready {
+			continue
+		}
+		if !state.isServedBy(gateway) {
+			continue
+		}
+		for _, h := range state.Hostnames {
+			if slices.Contains(scaledToZero, h) || slices.Contains(shadowing, readyHostPrefix+h) {
+				continue
+			}
+			if slices.ContainsFunc(scaledToZero, func(pattern string) bool { return hostnameMatches(pattern, h) }) {
+				shadowing = append(shadowing, readyHostPrefix+h)
+			}
+		}
+	}
+	return shadowing
+}
+
+// getState returns the readiness of all routes including the per-backend breakdown.
+// With ?gateway=<namespace>/<name> only routes attached to that Gateway are returned.
+func (c *RequestBufferController) getState(w http.ResponseWriter, r *http.Request) {
+	gateway := r.URL.Query().Get("gateway")
+
+	c.mux.RLock()
+	states := make([]RouteState, 0, len(c.routeStates))
+	for _, state := range c.routeStates {
+		if !state.isServedBy(gateway) {
+			continue
+		}
+		states = append(states, state)
+	}
+	c.mux.RUnlock()
+
+	jsonStr, err := json.Marshal(states)
+	if err != nil {
+		log.Println("failed to marshal routeStates, err: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(jsonStr)
+	if err != nil {
+		log.Printf("failed to write to output stream, err: %v\n", err)
+	}
+}
+
 func (c *RequestBufferController) pokeScaleUp(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	if c.forwardToLeader(w, r) {
+		return
+	}
 
 	err := r.ParseForm()
 	if err != nil {
@@ -184,233 +479,251 @@ func (c *RequestBufferController) pokeScaleUp(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	routes, err := c.httpRouteInformer.Lister().List(labels.Everything())
+	dem, err := parseDemand(r.Form.Get("pending"), r.Form.Get("rate"))
 	if err != nil {
-		log.Printf("failed to list HTTPRoutes: %v", err)
+		log.Printf("invalid demand for host %s: %v", hostname, err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	for _, rt := range routes {
-		for _, h := range rt.Spec.Hostnames {
-			if string(h) == hostname {
-				if err = c.triggerScaleUp(rt); err != nil {
-					log.Printf("Failed to trigger scale-up: %v", err)
-					w.WriteHeader(http.StatusInternalServerError)
-				} else {
-					w.WriteHeader(http.StatusOK)
-				}
-				return
+	rt := c.routeForPoke(hostname, r.Form.Get("entry"))
+	if rt == nil {
+		log.Printf("Host :%s was not found in any route", hostname)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// concurrent pokes of the route are coalesced into one scale-up operation
+	op, started := c.scaleUps.start(rt.key(), dem, c.desiredReplicas(rt.obj, dem))
+	if started {
+		go c.runScaleUp(rt, op, dem)
+	}
+
+	jsonStr, err := json.Marshal(op)
+	if err != nil {
+		log.Println("failed to marshal scale-up, err: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_, err = w.Write(jsonStr)
+	if err != nil {
+		log.Printf("failed to write to output stream, err: %v\n", err)
+	}
+}
+
+// routeForPoke returns the route that buffered the request to the host. The entry is the scaled to zero host the filter
+// matched, it distinguishes routes sharing the host, e.g. GRPCRoutes limited to different methods.
+// Routes that are scaled to zero are preferred over the most specific route of the host.
+func (c *RequestBufferController) routeForPoke(hostname, entry string) *route {
+	routes := c.routesForHost(hostname)
+	if len(routes) == 0 {
+		return nil
+	}
+
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if entry != "" {
+		for _, rt := range routes {
+			if slices.Contains(c.scaledToZeroTargets[rt.key()], entry) {
+				return rt
 			}
 		}
 	}
+	for _, rt := range routes {
+		if _, has := c.scaledToZeroTargets[rt.key()]; has {
+			return rt
+		}
+	}
+	return routes[0]
+}
+
+// routesOfMostSpecificHostname returns the routes of the most specific hostname that matches the host.
+// Like Envoy, requests are only routed to these routes, e.g. not to a catch-all route if a route has the exact host.
+func (c *RequestBufferController) routesOfMostSpecificHostname(hostname string) []*route {
+	for _, h := range matchingHostnames(hostname) {
+		if routes := c.routesByIndex(hostnameIndex, h); len(routes) > 0 {
+			return routes
+		}
+	}
+	return nil
+}
 
-	log.Printf("Host :%s was not found in any HTTPRoute", hostname)
-	w.WriteHeader(http.StatusNotFound)
+// routesForHost returns all routes that are served on the hostname, routes with the most specific hostname first
+func (c *RequestBufferController) routesForHost(hostname string) []*route {
+	var matching []*route
+	seen := make(map[string]bool)
+	for _, h := range matchingHostnames(hostname) {
+		for _, r := range c.routesByIndex(hostnameIndex, h) {
+			if !seen[r.key()] {
+				seen[r.key()] = true
+				matching = append(matching, r)
+			}
+		}
+	}
+	return matching
 }
 
-func (c *RequestBufferController) triggerScaleUp(rt *gwapiv1.HTTPRoute) error {
-	log.Printf("Triggering scale-up for HTTPRoute: %s/%s", rt.Namespace, rt.Name)
+// triggerScaleUp scales the workloads of the route and returns the ones that were scaled
+func (c *RequestBufferController) triggerScaleUp(r *route, dem demand) ([]string, error) {
+	replicas := c.desiredReplicas(r.obj, dem)
+	log.Printf("Triggering scale-up for %s to replicas=%d for %d pending requests at %.2f requests/s", r, replicas, dem.pending, dem.rate)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	for _, rule := range rt.Spec.Rules {
-		for _, ref := range rule.BackendRefs {
-			if *ref.Kind == "Service" {
-				// Get the Service labels
-				service, err := c.k8sClient.CoreV1().Services(rt.Namespace).Get(ctx, string(ref.Name), metav1.GetOptions{})
-				if err != nil {
-					return err
-				}
-
-				// Get the deployment pointing to the service
-				deployments, err := c.k8sClient.AppsV1().Deployments(rt.Namespace).List(ctx, metav1.ListOptions{})
-				if err != nil {
-					return err
-				}
-				if deployments == nil || len(deployments.Items) == 0 {
-					return fmt.Errorf("could not find any deployments in namespace: %s", rt.Namespace)
-				}
-
-				for _, d := range deployments.Items {
-					// Scale deployments where the Service selector matches the Deployment selectors
-					for k, v := range service.Spec.Selector {
-						if d.Spec.Selector.MatchLabels[k] == v {
-							log.Printf("Scaling up deployment: %s/%s to replica=1", d.Namespace, d.Name)
-							_, err = c.k8sClient.AppsV1().Deployments(rt.Namespace).UpdateScale(ctx, d.Name, &autoscalingv1.Scale{
-								ObjectMeta: metav1.ObjectMeta{
-									Name:      d.Name,
-									Namespace: d.Namespace,
-								},
-								Spec: autoscalingv1.ScaleSpec{
-									Replicas: 1,
-								},
-								Status: autoscalingv1.ScaleStatus{},
-							}, metav1.UpdateOptions{})
-							if err != nil {
-								return err
-							}
-						}
-					}
-				}
-			}
+	c.markScaledUp(r)
+
+	services, err := c.backendServices(r)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := c.scaleTargetsForServices(ctx, services)
+	if err != nil {
+		return nil, err
+	}
+
+	scaled := make([]string, 0, len(targets))
+	for _, t := range targets {
+		wakeReplicas := c.wakeReplicas(r.obj, t.obj, replicas)
+		if current, found := t.replicas(); found && current >= wakeReplicas {
+			// never scale down a target because of a poke
+			continue
+		}
+		if !c.scaleUps.claimTarget(r.key(), t.String(), wakeReplicas) {
+			log.Printf("%s is already scaled up by the operation of another route, skipping it for %s", t, r)
+			continue
 		}
+		log.Printf("Scaling up %s to replicas=%d", t, wakeReplicas)
+		c.scaleTargetEvent(t, corev1.EventTypeNormal, reasonScaleUpStarted, "Scaling up to %d replicas for %s", wakeReplicas, r)
+		if err := c.scale(ctx, t, wakeReplicas); err != nil {
+			c.scaleTargetEvent(t, corev1.EventTypeWarning, reasonScaleUpFailed, "Failed to scale up to %d replicas for %s: %v", wakeReplicas, r, err)
+			return scaled, err
+		}
+		c.scaleTargetEvent(t, corev1.EventTypeNormal, reasonScaleUpSucceeded, "Scaled up to %d replicas for %s", wakeReplicas, r)
+		scaled = append(scaled, t.String())
 	}
-	return nil
+	return scaled, nil
+}
+
+// backendServices returns all Services referenced as backends of the route from the lister, ignoring backends with a weight of zero
+func (c *RequestBufferController) backendServices(r *route) ([]*corev1.Service, error) {
+	var services []*corev1.Service
+	for _, ref := range r.backends {
+		if ref.weight == 0 {
+			continue
+		}
+		service, err := c.serviceInformer.Lister().Services(ref.namespace).Get(ref.name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	return services, nil
 }
 
 func (c *RequestBufferController) Run(stopCh chan struct{}) error {
 	c.k8sInformerFactory.Start(stopCh)
 	c.gwInformerFactory.Start(stopCh)
+	c.dynamicInformerFactory.Start(stopCh)
+	c.routeInformers.Start(stopCh)
 	// wait for the initial synchronization of the local cache.
-	if !cache.WaitForCacheSync(stopCh, c.endpointsInformer.Informer().HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, c.endpointSliceInformer.Informer().HasSynced, c.serviceInformer.Informer().HasSynced, c.scaleTargetsHaveSynced) {
 		return fmt.Errorf("failed to sync K8s informers")
 	}
-	if !cache.WaitForCacheSync(stopCh, c.httpRouteInformer.Informer().HasSynced) {
+	if c.watchesGatewayAPI() && !cache.WaitForCacheSync(stopCh, c.gatewayInformer.Informer().HasSynced, c.referenceGrantInformer.Informer().HasSynced) {
 		return fmt.Errorf("failed to sync GW-API informers")
 	}
-	return nil
-}
-
-func (c *RequestBufferController) handleRouteChange(route *gwapiv1.HTTPRoute) {
-	isReady := c.hasReadyEndpoints(route)
-	key := route.Namespace + splitter + route.Name
-
-	log.Printf("HTTPRoute %s is considered ready: %v\n", key, isReady)
-
-	c.mux.Lock()
-	defer c.mux.Unlock()
+	if !cache.WaitForCacheSync(stopCh, c.routeSourcesHaveSynced) {
+		return fmt.Errorf("failed to sync route informers")
+	}
 
-	_, has := c.scaledToZeroTargets[key]
+	for i := 0; i < c.options.workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	go func() {
+		<-stopCh
+		c.queue.ShutDown()
+	}()
 
-	switch {
-	case !has && isReady:
-		// noop, is not scaled to zero
-	case has && isReady:
-		// is no longer scaled to zero, need to remove it from the list
-		delete(c.scaledToZeroTargets, key)
-	case !isReady:
-		// is scaled to zero, need to add/or update it to our list (domains might have changed)
-		var domains []string
-		for _, h := range route.Spec.Hostnames {
-			domains = append(domains, string(h))
-		}
-		c.scaledToZeroTargets[key] = domains
+	if c.options.leaderElection {
+		go c.runLeaderElection(stopCh)
 	}
+	go c.runScaleDown(stopCh)
+	return nil
 }
 
-func (c *RequestBufferController) routeAdd(obj interface{}) {
-	route, ok := obj.(*gwapiv1.HTTPRoute)
-	if !ok {
-		log.Printf("object is not a HTTPRoute: %v", obj)
+func (c *RequestBufferController) handleEndpointSliceChange(slice *discoveryv1.EndpointSlice) {
+	serviceName, has := slice.Labels[discoveryv1.LabelServiceName]
+	if !has {
+		// not managed for a Service
 		return
 	}
-	c.handleRouteChange(route)
+	c.handleServiceChange(slice.Namespace, serviceName)
 }
 
-func (c *RequestBufferController) routeUpdate(_, new interface{}) {
-	route, ok := new.(*gwapiv1.HTTPRoute)
-	if !ok {
-		log.Printf("object is not a HTTPRoute: %v", new)
-		return
+// handleServiceChange re-evaluates all routes that reference the service, also from other namespaces
+func (c *RequestBufferController) handleServiceChange(namespace, serviceName string) {
+	for _, r := range c.routesByIndex(backendServiceIndex, namespace+splitter+serviceName) {
+		c.queue.Add(r.key())
 	}
-	c.handleRouteChange(route)
 }
 
-func (c *RequestBufferController) routeDelete(obj interface{}) {
-	route, ok := obj.(*gwapiv1.HTTPRoute)
+func (c *RequestBufferController) serviceAdd(obj interface{}) {
+	service, ok := obj.(*corev1.Service)
 	if !ok {
-		log.Printf("object is not a HTTP route: %v", obj)
+		log.Printf("object is not a Service: %v", obj)
 		return
 	}
-
-	key := route.Namespace + splitter + route.Name
-
-	c.mux.Lock()
-	defer c.mux.Unlock()
-
-	log.Printf("HTTPRoute %s was deleted, removing from scaledToZeroTargets", key)
-	delete(c.scaledToZeroTargets, key)
+	c.handleServiceChange(service.Namespace, service.Name)
 }
 
-func (c *RequestBufferController) handleEndpointChange(endpoint *corev1.Endpoints) {
-	routes, err := c.gwInformerFactory.Gateway().V1().HTTPRoutes().Lister().HTTPRoutes(endpoint.Namespace).List(labels.Everything())
-	if err != nil {
-		log.Printf("Failed to list HTTPRoutes in namespace: %s, %v", endpoint.Namespace, err)
-		// todo: better error management, fine for PoC
+func (c *RequestBufferController) serviceUpdate(_ interface{}, new interface{}) {
+	service, ok := new.(*corev1.Service)
+	if !ok {
+		log.Printf("object is not a Service: %v", new)
 		return
 	}
-
-	for _, rt := range routes {
-		for _, rule := range rt.Spec.Rules {
-			for _, ref := range rule.BackendRefs {
-				if *ref.Kind == "Service" && string(ref.Name) == endpoint.Name {
-					c.handleRouteChange(rt)
-				}
-			}
-		}
-	}
+	c.handleServiceChange(service.Namespace, service.Name)
 }
 
-func (c *RequestBufferController) endpointAdd(obj interface{}) {
-	ep, ok := obj.(*corev1.Endpoints)
+func (c *RequestBufferController) endpointSliceAdd(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
 	if !ok {
-		log.Printf("object is not an Endpoint: %v", obj)
+		log.Printf("object is not an EndpointSlice: %v", obj)
 		return
 	}
-	c.handleEndpointChange(ep)
+	c.handleEndpointSliceChange(slice)
 }
 
-func (c *RequestBufferController) endpointUpdate(_ interface{}, new interface{}) {
-	ep, ok := new.(*corev1.Endpoints)
+func (c *RequestBufferController) endpointSliceUpdate(_ interface{}, new interface{}) {
+	slice, ok := new.(*discoveryv1.EndpointSlice)
 	if !ok {
-		log.Printf("object is not an Endpoint: %v", new)
+		log.Printf("object is not an EndpointSlice: %v", new)
 		return
 	}
-	c.handleEndpointChange(ep)
-
+	c.handleEndpointSliceChange(slice)
 }
 
-func (c *RequestBufferController) endpointDelete(obj interface{}) {
-	ep, ok := obj.(*corev1.Endpoints)
+func (c *RequestBufferController) endpointSliceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
 	if !ok {
-		log.Printf("object is not an Endpoint: %v", obj)
+		log.Printf("object is not an EndpointSlice: %v", obj)
 		return
 	}
-	c.handleEndpointChange(ep)
+	c.handleEndpointSliceChange(slice)
 }
 
-func (c *RequestBufferController) hasReadyEndpoints(route *gwapiv1.HTTPRoute) bool {
-	readyEndpoints := make(map[string]bool)
-	endpoints, err := c.endpointsInformer.Lister().Endpoints(route.Namespace).List(labels.Everything())
-	if err != nil {
-		log.Printf("Failed to list endpoints in namespace: %s, %v", route.Namespace, err)
-		// todo: better error management, fine for PoC
-		return false
-	}
-	for _, ep := range endpoints {
-		for _, sub := range ep.Subsets {
-			// if we have at least one ready address we consider the endpoint ready
-			if len(sub.Addresses) > 0 {
-				readyEndpoints[ep.Name] = true
-				break
-			}
+// splitList splits a comma separated list of a flag, ignoring spaces and empty values
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
 		}
 	}
-
-	hasReadyEndpoints := true
-	// Make sure every rule + backend ref with type "Service" is ready
-	for _, r := range route.Spec.Rules {
-		for _, b := range r.BackendRefs {
-			// for now, we only handle "Service"
-			if *b.Kind == "Service" {
-				if _, has := readyEndpoints[string(b.Name)]; !has {
-					hasReadyEndpoints = false
-				}
-			}
-		}
-	}
-
-	return hasReadyEndpoints
+	return values
 }
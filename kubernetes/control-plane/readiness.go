@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceNameIndex indexes EndpointSlices by namespace/service-name
+const serviceNameIndex = "serviceName"
+
+const (
+	// readinessPolicyAll requires every backend to be ready
+	readinessPolicyAll = "all"
+	// readinessPolicyAny requires at least one backend to be ready
+	readinessPolicyAny = "any"
+	// readinessPolicyPerRule requires at least one ready backend per rule
+	readinessPolicyPerRule = "per-rule"
+)
+
+// RouteState is the readiness of a route and its backends
+type RouteState struct {
+	Route     string         `json:"route"`
+	Hostnames []string       `json:"hostnames"`
+	Methods   []string       `json:"methods,omitempty"`
+	Gateways  []string       `json:"gateways"`
+	Reason    string         `json:"reason,omitempty"`
+	Policy    string         `json:"policy"`
+	Ready     bool           `json:"ready"`
+	Backends  []BackendState `json:"backends"`
+}
+
+// isServedBy returns true if the route is attached to the Gateway (<namespace>/<name>). Routes without Gateways,
+// e.g. Ingresses, can be served by any Gateway. An empty gateway matches all routes.
+func (s RouteState) isServedBy(gateway string) bool {
+	return gateway == "" || len(s.Gateways) == 0 || slices.Contains(s.Gateways, gateway)
+}
+
+// BackendState is the readiness of a single backendRef of a route
+type BackendState struct {
+	Rule              int    `json:"rule"`
+	Service           string `json:"service"`
+	Port              *int32 `json:"port,omitempty"`
+	PortName          string `json:"port-name,omitempty"`
+	Weight            int32  `json:"weight"`
+	ReadyEndpoints    int    `json:"ready-endpoints"`
+	MinReadyEndpoints int    `json:"min-ready-endpoints"`
+	Ready             bool   `json:"ready"`
+	Error             string `json:"error,omitempty"`
+}
+
+// routeReadiness evaluates the readiness of every Service backendRef of the route and combines them according to the
+// readiness-policy of the route. Backends with a weight of zero never receive traffic and are ignored.
+func (c *RequestBufferController) routeReadiness(r *route) RouteState {
+	state := RouteState{
+		Route:     r.key(),
+		Hostnames: r.hostnames,
+		Methods:   r.methods,
+		Gateways:  r.gateways,
+		Reason:    r.reason,
+		Policy:    readinessPolicyAll,
+	}
+	if policy, has := r.obj.GetAnnotations()[readinessPolicyAnnotation]; has {
+		switch policy {
+		case readinessPolicyAll, readinessPolicyAny, readinessPolicyPerRule:
+			state.Policy = policy
+		default:
+			log.Printf("Invalid value %q for annotation %s on %s, using %q", policy, readinessPolicyAnnotation, state.Route, readinessPolicyAll)
+		}
+	}
+
+	allReady, anyReady, considered := true, false, 0
+	ruleReady := make(map[int]bool) // [rule]has a ready backend
+	for _, ref := range r.backends {
+		backend := c.backendReadiness(r, ref)
+		state.Backends = append(state.Backends, backend)
+		if backend.Weight == 0 {
+			continue
+		}
+
+		considered++
+		allReady = allReady && backend.Ready
+		anyReady = anyReady || backend.Ready
+		ruleReady[ref.rule] = ruleReady[ref.rule] || backend.Ready
+	}
+	rulesReady := true
+	for _, ready := range ruleReady {
+		rulesReady = rulesReady && ready
+	}
+
+	switch state.Policy {
+	case readinessPolicyAny:
+		state.Ready = anyReady || considered == 0
+	case readinessPolicyPerRule:
+		state.Ready = rulesReady
+	default:
+		state.Ready = allReady
+	}
+	return state
+}
+
+func (c *RequestBufferController) backendReadiness(r *route, ref serviceBackendRef) BackendState {
+	backend := BackendState{
+		Rule:    ref.rule,
+		Service: ref.String(),
+		Weight:  ref.weight,
+	}
+	if ref.port != nil {
+		port := int32(*ref.port)
+		backend.Port = &port
+	}
+	if ref.portName != nil {
+		backend.PortName = *ref.portName
+	}
+
+	var err error
+	backend.ReadyEndpoints, backend.MinReadyEndpoints, err = c.backendEndpoints(r.obj, ref)
+	if err != nil {
+		log.Printf("Failed to get readiness of service: %s, %v", backend.Service, err)
+		backend.Error = err.Error()
+		return backend
+	}
+	backend.Ready = backend.ReadyEndpoints >= backend.MinReadyEndpoints
+	return backend
+}
+
+// backendEndpoints returns the number of ready endpoints of the service on the referenced port, and how many are required.
+// By default, one ready endpoint is enough, this can be changed with the min-ready-endpoints annotation
+// on the route or service to an absolute number or a percentage of the desired replicas of the scale targets.
+func (c *RequestBufferController) backendEndpoints(route metav1.Object, ref serviceBackendRef) (int, int, error) {
+	service, err := c.serviceInformer.Lister().Services(ref.namespace).Get(ref.name)
+	if err != nil {
+		return 0, 1, err
+	}
+
+	portName, err := servicePortName(service, ref)
+	if err != nil {
+		return 0, 1, err
+	}
+	ready, err := c.readyEndpoints(ref.namespace, ref.name, portName)
+	if err != nil {
+		return 0, 1, err
+	}
+
+	minReady, err := c.minReadyEndpoints(route, service)
+	return ready, minReady, err
+}
+
+// servicePortName returns the name of the service port referenced by number or name, nil if any port is fine
+func servicePortName(service *corev1.Service, ref serviceBackendRef) (*string, error) {
+	switch {
+	case ref.port != nil:
+		for _, sp := range service.Spec.Ports {
+			if sp.Port == int32(*ref.port) {
+				return &sp.Name, nil
+			}
+		}
+		return nil, fmt.Errorf("service %s/%s has no port %d", service.Namespace, service.Name, *ref.port)
+	case ref.portName != nil:
+		for _, sp := range service.Spec.Ports {
+			if sp.Name == *ref.portName {
+				return &sp.Name, nil
+			}
+		}
+		return nil, fmt.Errorf("service %s/%s has no port %s", service.Namespace, service.Name, *ref.portName)
+	default:
+		return nil, nil
+	}
+}
+
+// minReadyEndpoints returns the number of ready endpoints required before a backend is considered ready
+func (c *RequestBufferController) minReadyEndpoints(route metav1.Object, service *corev1.Service) (int, error) {
+	var value string
+	for _, obj := range []metav1.Object{route, service} {
+		if v, has := obj.GetAnnotations()[minReadyEndpointsAnnotation]; has {
+			value = v
+			break
+		}
+	}
+	if value == "" {
+		return 1, nil
+	}
+
+	if percent, isPercent := strings.CutSuffix(value, "%"); isPercent {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 {
+			return 1, fmt.Errorf("invalid value %q for annotation %s", value, minReadyEndpointsAnnotation)
+		}
+		desired, err := c.desiredReplicasOfService(service)
+		if err != nil {
+			// without the desired replicas, a single ready endpoint is enough to not buffer the route forever
+			log.Printf("Failed to get the desired replicas of Service %s/%s for %s, requiring 1 ready endpoint: %v",
+				service.Namespace, service.Name, minReadyEndpointsAnnotation, err)
+			return 1, nil
+		}
+		return max(1, int(math.Ceil(float64(desired)*p/100))), nil
+	}
+
+	minReady, err := strconv.Atoi(value)
+	if err != nil || minReady < 0 {
+		return 1, fmt.Errorf("invalid value %q for annotation %s", value, minReadyEndpointsAnnotation)
+	}
+	return max(1, minReady), nil
+}
+
+// desiredReplicasOfService returns the sum of the desired replicas of all scale targets of the service
+func (c *RequestBufferController) desiredReplicasOfService(service *corev1.Service) (int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	targets, err := c.scaleTargetsForService(ctx, service)
+	if err != nil {
+		return 0, err
+	}
+	var desired int32
+	for _, t := range targets {
+		if replicas, found := t.replicas(); found {
+			desired += replicas
+		}
+	}
+	return desired, nil
+}
+
+// readyEndpoints returns the number of ready endpoints of the service, aggregated over all its EndpointSlices.
+// If portName is set, only endpoints in slices exposing the port are counted.
+func (c *RequestBufferController) readyEndpoints(namespace, serviceName string, portName *string) (int, error) {
+	objs, err := c.endpointSliceInformer.Informer().GetIndexer().ByIndex(serviceNameIndex, namespace+splitter+serviceName)
+	if err != nil {
+		return 0, err
+	}
+
+	// the same pod can be part of multiple slices, e.g. for IPv4 and IPv6
+	ready := make(map[string]bool)
+	for _, obj := range objs {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			continue
+		}
+		if portName != nil && !hasPort(slice, *portName) {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if isEndpointReady(ep.Conditions) && len(ep.Addresses) > 0 {
+				ready[endpointKey(ep)] = true
+			}
+		}
+	}
+	return len(ready), nil
+}
+
+// hasPort returns true if the slice exposes the (target) port of the service port with the name
+func hasPort(slice *discoveryv1.EndpointSlice, portName string) bool {
+	for _, p := range slice.Ports {
+		name := ""
+		if p.Name != nil {
+			name = *p.Name
+		}
+		if name == portName {
+			return true
+		}
+	}
+	return false
+}
+
+func endpointKey(ep discoveryv1.Endpoint) string {
+	if ep.TargetRef != nil {
+		return ep.TargetRef.Namespace + splitter + ep.TargetRef.Name
+	}
+	return ep.Addresses[0]
+}
+
+// isEndpointReady returns true if the endpoint is ready to receive traffic. Terminating endpoints are never considered ready.
+// As defined by the API, unknown (nil) conditions are interpreted as ready.
+func isEndpointReady(conditions discoveryv1.EndpointConditions) bool {
+	if conditions.Terminating != nil && *conditions.Terminating {
+		return false
+	}
+	if conditions.Ready != nil {
+		return *conditions.Ready
+	}
+	if conditions.Serving != nil {
+		return *conditions.Serving
+	}
+	return true
+}
+
+func endpointSliceServiceNameIndexFunc(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+	serviceName, has := slice.Labels[discoveryv1.LabelServiceName]
+	if !has {
+		return nil, nil
+	}
+	return []string{slice.Namespace + splitter + serviceName}, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxRetries is the number of times a route is retried before it is dropped from the queue.
+// It is reconciled again on the next change of the route or its Services.
+const maxRetries = 5
+
+func newRouteQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{
+		Name: "routes",
+	})
+}
+
+// enqueueRoute adds the key of the object of the route source to the queue
+func (c *RequestBufferController) enqueueRoute(src routeSource, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		log.Printf("object is not a %s: %v", src.kind, obj)
+		return
+	}
+	c.queue.Add(routeKey(src.kind, o))
+}
+
+// runWorker processes routes of the queue until it is shut down
+func (c *RequestBufferController) runWorker() {
+	for c.processNextRoute() {
+	}
+}
+
+func (c *RequestBufferController) processNextRoute() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.reconcile(key.(string))
+	switch {
+	case err == nil:
+		c.queue.Forget(key)
+	case c.queue.NumRequeues(key) < maxRetries:
+		log.Printf("Failed to reconcile %s, retrying: %v", key, err)
+		c.queue.AddRateLimited(key)
+	default:
+		log.Printf("Failed to reconcile %s, dropping it from the queue: %v", key, err)
+		c.queue.Forget(key)
+	}
+	return true
+}
+
+// reconcile derives the state of the route with the key (<kind>/<namespace>/<name>) from the listers
+func (c *RequestBufferController) reconcile(key string) error {
+	kind, name, _ := strings.Cut(key, splitter)
+	var src *routeSource
+	for i := range c.routeSources {
+		if c.routeSources[i].kind == kind {
+			src = &c.routeSources[i]
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("no route source for %s", key)
+	}
+
+	obj, exists, err := src.informer.GetStore().GetByKey(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.removeRoute(key)
+		return nil
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if !c.isBufferedRoute(o) {
+		// e.g. a route that opted out of buffering
+		c.removeRoute(key)
+		return nil
+	}
+	r, ok := src.toRoute(obj)
+	if !ok {
+		// e.g. an Ingress that changed to another class
+		c.removeRoute(key)
+		return nil
+	}
+	return c.updateRoute(r)
+}
+
+// updateRoute evaluates the readiness of the route and updates the scaled to zero state.
+// Errors of backends are returned after the state is updated, so the route is retried.
+func (c *RequestBufferController) updateRoute(r *route) error {
+	state := c.routeReadiness(r)
+	isReady := state.Ready
+	key := r.key()
+
+	log.Printf("%s is considered ready: %v\n", key, isReady)
+
+	if err := c.routes.Update(r); err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	c.routeStates[key] = state
+
+	_, has := c.scaledToZeroTargets[key]
+	released := has && isReady
+
+	switch {
+	case !has && isReady:
+		// noop, is not scaled to zero
+	case has && isReady:
+		// is no longer scaled to zero, need to remove it from the list
+		delete(c.scaledToZeroTargets, key)
+		// the min-up-time also applies to workloads woken without a poke, e.g. by kubectl scale or an HPA
+		c.scaledUpAt[key] = time.Now()
+	case !isReady:
+		// is scaled to zero, need to add/or update it to our list (domains might have changed)
+		c.scaledToZeroTargets[key] = r.hosts()
+	}
+	c.mux.Unlock()
+
+	if released && c.isLeader() {
+		c.routeEvent(r, corev1.EventTypeNormal, reasonBufferReleased, "Backends are ready, releasing buffered requests")
+	}
+	if err := c.setRouteCondition(r, scaledToZeroStatus(r, state)); err != nil {
+		return fmt.Errorf("failed to set %s condition: %w", scaledToZeroCondition, err)
+	}
+
+	for _, b := range state.Backends {
+		if b.Error != "" {
+			return fmt.Errorf("backend %s: %s", b.Service, b.Error)
+		}
+	}
+	return nil
+}
+
+// removeRoute removes all state of a route that was deleted or is no longer buffered
+func (c *RequestBufferController) removeRoute(key string) {
+	if r, exists, _ := c.routes.GetByKey(key); exists {
+		if err := c.routes.Delete(r); err != nil {
+			log.Printf("Failed to remove %s from the index: %v", key, err)
+		}
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if _, has := c.routeStates[key]; !has {
+		return
+	}
+	log.Printf("%s was deleted or is no longer buffered, removing from scaledToZeroTargets", key)
+	delete(c.scaledToZeroTargets, key)
+	delete(c.scaledUpAt, key)
+	delete(c.routeStates, key)
+	c.activity.remove(key)
+}
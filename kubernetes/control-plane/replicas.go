@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// wakeReplicas returns the replicas to restore the scale target to on wake-up. This is the explicit wake-replicas annotation
+// (on the target or route) or the replicas the target had before it was scaled to zero, if higher than the replicas for the demand.
+// The result is capped by the max replicas of the route.
+func (c *RequestBufferController) wakeReplicas(rt metav1.Object, target metav1.Object, demandReplicas int32) int32 {
+	maxReplicas, err := int32Annotation(rt, maxReplicasAnnotation, c.options.maxReplicas)
+	if err != nil {
+		log.Println(err)
+	}
+
+	wake := int32(-1)
+	for _, obj := range []metav1.Object{target, rt} {
+		if wake, err = int32Annotation(obj, wakeReplicasAnnotation, -1); err != nil {
+			log.Println(err)
+		}
+		if wake >= 0 {
+			break
+		}
+	}
+	if wake < 0 {
+		if wake, err = int32Annotation(target, previousReplicasAnnotation, -1); err != nil {
+			log.Println(err)
+		}
+	}
+
+	replicas := max(demandReplicas, wake)
+	if replicas > maxReplicas {
+		replicas = maxReplicas
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	return replicas
+}
+
+func (c *RequestBufferController) scaleTargetUpdate(mapping *meta.RESTMapping, old, new interface{}) {
+	oldObj, ok := old.(*unstructured.Unstructured)
+	if !ok {
+		log.Printf("object is not a %s: %v", mapping.GroupVersionKind.Kind, old)
+		return
+	}
+	newObj, ok := new.(*unstructured.Unstructured)
+	if !ok {
+		log.Printf("object is not a %s: %v", mapping.GroupVersionKind.Kind, new)
+		return
+	}
+
+	if !c.isLeader() {
+		return
+	}
+
+	// Record the replicas when a target is scaled to zero (by us or an operator) to restore them on wake-up
+	oldReplicas, _ := scaleTarget{mapping: mapping, obj: oldObj}.replicas()
+	newTarget := scaleTarget{mapping: mapping, obj: newObj}
+	if newReplicas, found := newTarget.replicas(); found && oldReplicas > 0 && newReplicas == 0 {
+		if err := c.recordPreviousReplicas(newTarget, oldReplicas); err != nil {
+			log.Printf("Failed to record previous replicas of %s: %v", newTarget, err)
+		}
+	}
+}
+
+func (c *RequestBufferController) recordPreviousReplicas(t scaleTarget, replicas int32) error {
+	log.Printf("%s was scaled to zero from replicas=%d", t, replicas)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, previousReplicasAnnotation, strconv.Itoa(int(replicas)))
+	_, err := c.dynamicClient.Resource(t.mapping.Resource).Namespace(t.obj.GetNamespace()).Patch(ctx, t.obj.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// hostnameIndex indexes routes by the hostnames they are served on
+	hostnameIndex = "hostname"
+	// backendServiceIndex indexes routes by the namespace/name of their backend Services
+	backendServiceIndex = "backendService"
+)
+
+// newRouteIndex creates the index of all resolved routes. Routes are indexed after they are resolved, as their hostnames
+// can depend on other resources, e.g. the listeners of a Gateway.
+func newRouteIndex() cache.Indexer {
+	return cache.NewIndexer(routeKeyFunc, cache.Indexers{
+		hostnameIndex:       routeHostnameIndexFunc,
+		backendServiceIndex: routeBackendServiceIndexFunc,
+	})
+}
+
+func routeKeyFunc(obj interface{}) (string, error) {
+	r, ok := obj.(*route)
+	if !ok {
+		return "", fmt.Errorf("object is not a route: %v", obj)
+	}
+	return r.key(), nil
+}
+
+func routeHostnameIndexFunc(obj interface{}) ([]string, error) {
+	r, ok := obj.(*route)
+	if !ok {
+		return nil, nil
+	}
+	return r.hostnames, nil
+}
+
+func routeBackendServiceIndexFunc(obj interface{}) ([]string, error) {
+	r, ok := obj.(*route)
+	if !ok {
+		return nil, nil
+	}
+	services := make([]string, 0, len(r.backends))
+	for _, ref := range r.backends {
+		services = append(services, ref.String())
+	}
+	return services, nil
+}
+
+// routesByIndex returns the routes in the index with the value
+func (c *RequestBufferController) routesByIndex(index, value string) []*route {
+	objs, err := c.routes.ByIndex(index, value)
+	if err != nil {
+		log.Printf("Failed to get routes by index %s: %v", index, err)
+		return nil
+	}
+	routes := make([]*route, 0, len(objs))
+	for _, obj := range objs {
+		if r, ok := obj.(*route); ok {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// matchingHostnames returns all hostnames of routes that can match the host, the most specific first.
+// E.g. for foo.example.com these are foo.example.com, *.example.com, *.com and *.
+func matchingHostnames(host string) []string {
+	hostnames := []string{host}
+	for suffix := host; ; {
+		i := strings.Index(suffix, ".")
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+		hostnames = append(hostnames, "*."+suffix)
+	}
+	return append(hostnames, wildcardHostname)
+}
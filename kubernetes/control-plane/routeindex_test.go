@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	benchmarkRoutes     = 10000
+	benchmarkNamespaces = 100
+	benchmarkDomains    = 50
+	// benchmarkServices is the number of Services per namespace, each Service is the backend of multiple routes
+	benchmarkServices = 10
+)
+
+// newBenchmarkController returns a controller with an index of 10k routes. Most routes have an exact hostname,
+// every 10th route a wildcard hostname and every 100th route no hostname at all ("*").
+func newBenchmarkController(b *testing.B) *RequestBufferController {
+	c := &RequestBufferController{
+		routes: newRouteIndex(),
+		queue:  newRouteQueue(),
+	}
+	b.Cleanup(c.queue.ShutDown)
+
+	for i := 0; i < benchmarkRoutes; i++ {
+		namespace := fmt.Sprintf("ns-%d", i%benchmarkNamespaces)
+		domain := fmt.Sprintf("domain-%d.example.com", i%benchmarkDomains)
+
+		var hostname string
+		switch {
+		case i%100 == 0:
+			hostname = wildcardHostname
+		case i%10 == 0:
+			hostname = "*." + domain
+		default:
+			hostname = fmt.Sprintf("host-%d.%s", i, domain)
+		}
+
+		r := &route{
+			kind:      httpRouteKind,
+			obj:       &metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("route-%d", i)},
+			hostnames: []string{hostname},
+			backends: []serviceBackendRef{{
+				namespace: namespace,
+				name:      fmt.Sprintf("svc-%d", (i/benchmarkNamespaces)%benchmarkServices),
+				weight:    1,
+			}},
+		}
+		if err := c.routes.Add(r); err != nil {
+			b.Fatalf("failed to add %s to the index: %v", r, err)
+		}
+	}
+	return c
+}
+
+func BenchmarkRoutesForHost(b *testing.B) {
+	c := newBenchmarkController(b)
+	hosts := []string{
+		// exact hostname
+		"host-1.domain-1.example.com",
+		// matched by a wildcard hostname
+		"unknown.domain-10.example.com",
+		// only matched by "*"
+		"unknown.other.org",
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if routes := c.routesForHost(hosts[i%len(hosts)]); len(routes) == 0 {
+			b.Fatalf("no routes for %s", hosts[i%len(hosts)])
+		}
+	}
+}
+
+func BenchmarkHandleServiceChange(b *testing.B) {
+	c := newBenchmarkController(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.handleServiceChange(fmt.Sprintf("ns-%d", i%benchmarkNamespaces), fmt.Sprintf("svc-%d", i%benchmarkServices))
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// route is a resource of any route source that routes requests of the gateways to Services,
+// resolved to the hostnames Envoy serves it on and the backends requests are sent to
+type route struct {
+	kind      string
+	obj       metav1.Object
+	hostnames []string
+	gateways  []string
+	backends  []serviceBackendRef
+	// methods are the gRPC services (/<service>/) and methods (/<service>/<method>) the route is limited to, empty for all requests
+	methods []string
+	// reason explains how the route was resolved, if it deviates from the usual resolution
+	reason string
+}
+
+func (r *route) key() string {
+	return routeKey(r.kind, r.obj)
+}
+
+func (r *route) String() string {
+	return r.key()
+}
+
+// hosts returns the entries published to the filters. For routes limited to gRPC services or methods,
+// these are appended to the hostnames, e.g. grpc.example.com/helloworld.Greeter/SayHello
+func (r *route) hosts() []string {
+	if len(r.methods) == 0 {
+		return r.hostnames
+	}
+	hosts := make([]string, 0, len(r.hostnames)*len(r.methods))
+	for _, h := range r.hostnames {
+		for _, m := range r.methods {
+			hosts = append(hosts, h+m)
+		}
+	}
+	return hosts
+}
+
+func routeKey(kind string, obj metav1.Object) string {
+	return kind + splitter + obj.GetNamespace() + splitter + obj.GetName()
+}
+
+// routeSource is a kind of resource that routes requests of the gateways to Services
+type routeSource struct {
+	kind     string
+	informer cache.SharedIndexInformer
+	// dependencies are other informers toRoute reads from, all routes are re-evaluated on their changes
+	dependencies []cache.SharedIndexInformer
+	// toRoute resolves an object of the informer to a route, false if it is invalid or should not be buffered
+	toRoute func(obj interface{}) (*route, bool)
+}
+
+// routeSourceKinds are the kinds of route sources that can be selected
+var routeSourceKinds = []string{httpRouteKind, grpcRouteKind, virtualServiceKind, ingressKind}
+
+// parseRouteSources parses a comma separated list of route source kinds
+func parseRouteSources(s string) ([]string, error) {
+	var kinds []string
+	for _, kind := range splitList(s) {
+		if !slices.Contains(routeSourceKinds, kind) {
+			return nil, fmt.Errorf("unknown route source %q, expected one of %s", kind, strings.Join(routeSourceKinds, ", "))
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// newRouteSources creates a route source for each of the kinds, kinds that are not installed in the cluster are skipped
+func (c *RequestBufferController) newRouteSources(kinds []string) []routeSource {
+	var sources []routeSource
+	for _, kind := range kinds {
+		var src routeSource
+		var err error
+		switch kind {
+		case httpRouteKind:
+			src, err = c.newHTTPRouteSource()
+		case grpcRouteKind:
+			src, err = c.newGRPCRouteSource()
+		case virtualServiceKind:
+			src, err = c.newVirtualServiceSource()
+		case ingressKind:
+			src, err = c.newIngressSource()
+		}
+		if err != nil {
+			log.Printf("Skipping route source %s, it is not available in the cluster: %v", kind, err)
+			continue
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// watchesGatewayAPI returns true if routes of the Gateway API are watched, which need Gateways and ReferenceGrants
+func (c *RequestBufferController) watchesGatewayAPI() bool {
+	for _, src := range c.routeSources {
+		if src.kind == httpRouteKind || src.kind == grpcRouteKind {
+			return true
+		}
+	}
+	return false
+}
+
+// resyncRoutes re-evaluates all routes, this is used for changes of resources that are rare and can affect routes in any namespace
+func (c *RequestBufferController) resyncRoutes() {
+	for _, src := range c.routeSources {
+		for _, obj := range src.informer.GetStore().List() {
+			c.enqueueRoute(src, obj)
+		}
+	}
+}
+
+func (c *RequestBufferController) addRouteEventHandlers() error {
+	for _, src := range c.routeSources {
+		src := src
+		_, err := src.informer.AddEventHandler(
+			cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					c.enqueueRoute(src, obj)
+				},
+				UpdateFunc: func(old, new interface{}) {
+					c.enqueueRoute(src, new)
+				},
+				DeleteFunc: func(obj interface{}) {
+					c.enqueueRoute(src, obj)
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		for _, dep := range src.dependencies {
+			_, err := dep.AddEventHandler(
+				cache.ResourceEventHandlerFuncs{
+					AddFunc: func(obj interface{}) {
+						c.resyncRoutes()
+					},
+					UpdateFunc: func(old, new interface{}) {
+						c.resyncRoutes()
+					},
+					DeleteFunc: func(obj interface{}) {
+						c.resyncRoutes()
+					},
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *RequestBufferController) routeSourcesHaveSynced() bool {
+	for _, src := range c.routeSources {
+		if !src.informer.HasSynced() {
+			return false
+		}
+		for _, dep := range src.dependencies {
+			if !dep.HasSynced() {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const scaleDownInterval = 30 * time.Second
+
+// runScaleDown periodically scales the workloads of idle routes to zero
+func (c *RequestBufferController) runScaleDown(stopCh <-chan struct{}) {
+	wait.Until(c.scaleDownIdleRoutes, scaleDownInterval, stopCh)
+}
+
+func (c *RequestBufferController) scaleDownIdleRoutes() {
+	if !c.isLeader() {
+		return
+	}
+	for _, obj := range c.routes.List() {
+		r, ok := obj.(*route)
+		if !ok {
+			continue
+		}
+		if err := c.scaleDownIfIdle(r); err != nil {
+			log.Printf("Failed to scale down %s: %v", r, err)
+		}
+	}
+}
+
+// scaleDownIfIdle scales the workloads of the route to zero, if the route has an idle-timeout (on the route or its Services)
+// and did not receive traffic within the timeout. Workloads are kept up for at least the min-up-time after a scale-up.
+// Workloads of Services shared with other routes are only scaled down, if all of these routes are idle.
+func (c *RequestBufferController) scaleDownIfIdle(r *route) error {
+	key := r.key()
+
+	c.mux.RLock()
+	_, scaledToZero := c.scaledToZeroTargets[key]
+	c.mux.RUnlock()
+	if scaledToZero {
+		return nil
+	}
+
+	idle, idleTimeout, err := c.isIdle(r)
+	if err != nil || !idle {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	services, err := c.backendServices(r)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if active := c.activeRouteOfService(service, r); active != nil {
+			log.Printf("%s was idle for %v, but Service %s/%s is also used by %s, which is not idle", key, idleTimeout, service.Namespace, service.Name, active)
+			continue
+		}
+		targets, err := c.scaleTargetsForService(ctx, service)
+		if err != nil {
+			return err
+		}
+		for _, t := range targets {
+			if replicas, found := t.replicas(); found && replicas == 0 {
+				continue
+			}
+			log.Printf("%s was idle for %v, scaling down %s to replicas=0", key, idleTimeout, t)
+			if err := c.scale(ctx, t, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isIdle returns true and the idle-timeout, if the route has an idle-timeout and did not receive traffic within it
+// and its min-up-time after the last scale-up passed
+func (c *RequestBufferController) isIdle(r *route) (bool, time.Duration, error) {
+	key := r.key()
+
+	c.mux.RLock()
+	scaledUp := c.scaledUpAt[key]
+	c.mux.RUnlock()
+
+	services, err := c.backendServices(r)
+	if err != nil {
+		return false, 0, err
+	}
+	objs := []metav1.Object{r.obj}
+	for _, s := range services {
+		objs = append(objs, s)
+	}
+
+	idleTimeout, has, err := durationAnnotation(idleTimeoutAnnotation, objs...)
+	if err != nil || !has {
+		return false, 0, err
+	}
+	minUpTime, has, err := durationAnnotation(minUpTimeAnnotation, objs...)
+	if err != nil {
+		return false, 0, err
+	}
+	if !has {
+		minUpTime = c.options.minUpTime
+	}
+
+	// we do not know about traffic before this replica became the leader
+	up := latest(c.leader.leadingSince(), scaledUp)
+	if time.Since(up) < minUpTime {
+		return false, idleTimeout, nil
+	}
+	activity, _ := c.activity.get(key)
+	idle := time.Since(latest(up, activity.LastSeen)) >= idleTimeout
+	return idle, idleTimeout, nil
+}
+
+// activeRouteOfService returns another route with the Service as backend that is not idle, nil if there is none
+func (c *RequestBufferController) activeRouteOfService(service *corev1.Service, r *route) *route {
+	for _, other := range c.routesByIndex(backendServiceIndex, service.Namespace+splitter+service.Name) {
+		if other.key() == r.key() {
+			continue
+		}
+		idle, _, err := c.isIdle(other)
+		if err != nil {
+			log.Printf("Failed to check if %s is idle: %v", other, err)
+		}
+		if !idle {
+			return other
+		}
+	}
+	return nil
+}
+
+// markScaledUp records the time of the scale-up for the min-up-time stabilisation window
+func (c *RequestBufferController) markScaledUp(r *route) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.scaledUpAt[r.key()] = time.Now()
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
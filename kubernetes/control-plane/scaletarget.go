@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// scaleTarget is a workload that can be scaled via its /scale subresource, e.g. a Deployment, StatefulSet or Argo Rollout
+type scaleTarget struct {
+	mapping *meta.RESTMapping
+	obj     *unstructured.Unstructured
+}
+
+func (t scaleTarget) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", t.mapping.GroupVersionKind.Group, t.mapping.GroupVersionKind.Kind, t.obj.GetNamespace(), t.obj.GetName())
+}
+
+// replicas returns spec.replicas of the target, if it is known
+func (t scaleTarget) replicas() (int32, bool) {
+	replicas, found, err := unstructured.NestedInt64(t.obj.Object, "spec", "replicas")
+	if err != nil || !found {
+		return 0, false
+	}
+	return int32(replicas), true
+}
+
+// scaleTargetInformer watches all objects of a scale target kind
+type scaleTargetInformer struct {
+	mapping  *meta.RESTMapping
+	informer informers.GenericInformer
+}
+
+// parseGroupKinds parses a comma separated list of <group>/<kind>, e.g. apps/Deployment,argoproj.io/Rollout
+func parseGroupKinds(s string) ([]schema.GroupKind, error) {
+	var gks []schema.GroupKind
+	for _, gk := range strings.Split(s, ",") {
+		if gk = strings.TrimSpace(gk); gk == "" {
+			continue
+		}
+		group, kind, ok := strings.Cut(gk, "/")
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("invalid scale target kind %q, expected <group>/<kind>", gk)
+		}
+		gks = append(gks, schema.GroupKind{Group: group, Kind: kind})
+	}
+	return gks, nil
+}
+
+// newScaleTargetInformers creates an informer for each of the kinds, kinds that are not installed in the cluster are skipped
+func newScaleTargetInformers(restMapper meta.RESTMapper, factory dynamicinformer.DynamicSharedInformerFactory, kinds []schema.GroupKind) map[schema.GroupKind]scaleTargetInformer {
+	scaleTargetInformers := make(map[schema.GroupKind]scaleTargetInformer)
+	for _, gk := range kinds {
+		mapping, err := restMapper.RESTMapping(gk)
+		if err != nil {
+			log.Printf("Skipping scale target kind %s, it is not available in the cluster: %v", gk, err)
+			continue
+		}
+		scaleTargetInformers[gk] = scaleTargetInformer{
+			mapping:  mapping,
+			informer: factory.ForResource(mapping.Resource),
+		}
+	}
+	return scaleTargetInformers
+}
+
+// scaleTargetsForService returns the scale targets of the Service. This is either the target in the scale-target annotation
+// (<group>/<kind>/<name>), or all workloads of the watched kinds where the Service selector matches the workload selector.
+func (c *RequestBufferController) scaleTargetsForService(ctx context.Context, service *corev1.Service) ([]scaleTarget, error) {
+	if ref, has := service.Annotations[scaleTargetAnnotation]; has {
+		target, err := c.getScaleTarget(ctx, service.Namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+		return []scaleTarget{target}, nil
+	}
+
+	var matching []scaleTarget
+	for _, sti := range c.scaleTargetInformers {
+		objs, err := sti.informer.Lister().ByNamespace(service.Namespace).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objs {
+			obj, ok := o.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if selectsWorkload(service.Spec.Selector, obj) {
+				matching = append(matching, scaleTarget{mapping: sti.mapping, obj: obj})
+			}
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("could not find any scale target for service: %s/%s", service.Namespace, service.Name)
+	}
+	return matching, nil
+}
+
+// scaleTargetsForServices returns the de-duplicated scale targets of all Services
+func (c *RequestBufferController) scaleTargetsForServices(ctx context.Context, services []*corev1.Service) ([]scaleTarget, error) {
+	seen := make(map[string]bool)
+	var targets []scaleTarget
+	for _, service := range services {
+		serviceTargets, err := c.scaleTargetsForService(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range serviceTargets {
+			if !seen[t.String()] {
+				seen[t.String()] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// selectsWorkload returns true if the Service selector selects the pods of the workload.
+// The selector has to match the labels of the pod template, for workloads without a pod template
+// the selector labels have to satisfy the workload selector (including matchExpressions).
+func selectsWorkload(serviceSelector map[string]string, obj *unstructured.Unstructured) bool {
+	if len(serviceSelector) == 0 {
+		// a Service without selector does not select any pods
+		return false
+	}
+	selector := labels.SelectorFromSet(serviceSelector)
+
+	if podLabels, found, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels"); found {
+		return selector.Matches(labels.Set(podLabels))
+	}
+
+	ls := &metav1.LabelSelector{}
+	raw, found, _ := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if !found {
+		return false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, ls); err != nil {
+		return false
+	}
+	workloadSelector, err := metav1.LabelSelectorAsSelector(ls)
+	if err != nil || workloadSelector.Empty() {
+		return false
+	}
+	return workloadSelector.Matches(labels.Set(serviceSelector))
+}
+
+// getScaleTarget resolves a <group>/<kind>/<name> reference in the namespace, using the RESTMapper for kinds we do not watch
+func (c *RequestBufferController) getScaleTarget(ctx context.Context, namespace, ref string) (scaleTarget, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return scaleTarget{}, fmt.Errorf("invalid %s annotation %q, expected <group>/<kind>/<name>", scaleTargetAnnotation, ref)
+	}
+	gk := schema.GroupKind{Group: parts[0], Kind: parts[1]}
+	name := parts[2]
+
+	if sti, has := c.scaleTargetInformers[gk]; has {
+		o, err := sti.informer.Lister().ByNamespace(namespace).Get(name)
+		if err != nil {
+			return scaleTarget{}, err
+		}
+		obj, ok := o.(*unstructured.Unstructured)
+		if !ok {
+			return scaleTarget{}, fmt.Errorf("object is not unstructured: %v", o)
+		}
+		return scaleTarget{mapping: sti.mapping, obj: obj}, nil
+	}
+
+	mapping, err := c.restMapper.RESTMapping(gk)
+	if err != nil {
+		return scaleTarget{}, err
+	}
+	obj, err := c.dynamicClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return scaleTarget{}, err
+	}
+	return scaleTarget{mapping: mapping, obj: obj}, nil
+}
+
+// scale sets the replicas of the target using the /scale subresource
+func (c *RequestBufferController) scale(ctx context.Context, t scaleTarget, replicas int32) error {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	_, err := c.scaleClient.Scales(t.obj.GetNamespace()).Patch(ctx, t.mapping.Resource, t.obj.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+func (c *RequestBufferController) addScaleTargetEventHandlers() error {
+	for _, sti := range c.scaleTargetInformers {
+		sti := sti
+		_, err := sti.informer.Informer().AddEventHandler(
+			cache.ResourceEventHandlerFuncs{
+				UpdateFunc: func(old, new interface{}) {
+					c.scaleTargetUpdate(sti.mapping, old, new)
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RequestBufferController) scaleTargetsHaveSynced() bool {
+	for _, sti := range c.scaleTargetInformers {
+		if !sti.informer.Informer().HasSynced() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	scaleUpRunning   = "Running"
+	scaleUpSucceeded = "Succeeded"
+	scaleUpFailed    = "Failed"
+)
+
+// ScaleUp is a scale-up operation of a route
+type ScaleUp struct {
+	Route string `json:"route"`
+	// Replicas is the desired replicas of the demand the operation was started for
+	Replicas int32      `json:"replicas"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Status   string     `json:"status"`
+	Scaled   []string   `json:"scaled,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// scaleUpTracker coalesces concurrent pokes of a route into one scale-up operation.
+// Succeeded operations are kept for the cooldown, pokes within the cooldown do not start a new operation,
+// unless their demand needs more replicas. Pokes with a higher demand during a running operation start a follow-up once it finished.
+// The cooldown is also enforced per scale target, so routes sharing a target do not scale it again right after each other.
+type scaleUpTracker struct {
+	mux        sync.Mutex
+	cooldown   time.Duration
+	operations map[string]*ScaleUp       // [route]last operation
+	followUps  map[string]followUp       // [route]highest demand of pokes that joined the running operation
+	targets    map[string]*targetScaleUp // [scale target]last scale-up of the target
+}
+
+// followUp is the demand of a poke that needs more replicas than the running operation of the route
+type followUp struct {
+	demand   demand
+	replicas int32
+}
+
+// targetScaleUp is the last scale-up of a scale target by the operation of a route
+type targetScaleUp struct {
+	route    string
+	replicas int32
+	finished *time.Time
+	failed   bool
+}
+
+func newScaleUpTracker(cooldown time.Duration) *scaleUpTracker {
+	return &scaleUpTracker{
+		cooldown:   cooldown,
+		operations: make(map[string]*ScaleUp),
+		followUps:  make(map[string]followUp),
+		targets:    make(map[string]*targetScaleUp),
+	}
+}
+
+// start starts a new operation for the route and the demand of a poke, that needs the replicas.
+// No operation is started while one is running or in its cooldown, unless it was started for less replicas.
+// It returns the current operation and true if it was started.
+func (t *scaleUpTracker) start(route string, dem demand, replicas int32) (ScaleUp, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if op, has := t.operations[route]; has && t.isActive(op) {
+		if replicas <= op.Replicas {
+			return *op, false
+		}
+		if op.Finished == nil {
+			// keep the highest demand, the running operation is sized for less replicas
+			if f, has := t.followUps[route]; !has || replicas > f.replicas {
+				t.followUps[route] = followUp{demand: dem, replicas: replicas}
+			}
+			return *op, false
+		}
+	}
+	op := &ScaleUp{
+		Route:    route,
+		Replicas: replicas,
+		Started:  time.Now(),
+		Status:   scaleUpRunning,
+	}
+	t.operations[route] = op
+	return *op, true
+}
+
+// claimTarget claims the scale target for the running operation of the route until it finished.
+// It returns false if the target is scaled by the operation of another route, or was scaled to at least
+// the replicas within the cooldown.
+func (t *scaleUpTracker) claimTarget(route, target string, replicas int32) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if last, has := t.targets[target]; has && last.route != route && t.isActiveTarget(last) {
+		if last.finished == nil || last.replicas >= replicas {
+			return false
+		}
+	}
+	t.targets[target] = &targetScaleUp{route: route, replicas: replicas}
+	return true
+}
+
+// finish records the result of the running operation of the route and of its scale targets.
+// It returns the finished operation and the highest demand of the pokes that joined it, if there were any.
+func (t *scaleUpTracker) finish(route string, scaled []string, err error) (ScaleUp, *followUp) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := time.Now()
+	for _, last := range t.targets {
+		if last.route == route && last.finished == nil {
+			last.finished = &now
+			last.failed = err != nil
+		}
+	}
+
+	op, has := t.operations[route]
+	if !has {
+		op = &ScaleUp{Route: route}
+	}
+	op.Finished = &now
+	op.Scaled = scaled
+	op.Status = scaleUpSucceeded
+	if err != nil {
+		op.Status = scaleUpFailed
+		op.Error = err.Error()
+	}
+
+	f, hasFollowUp := t.followUps[route]
+	delete(t.followUps, route)
+	if !hasFollowUp {
+		return *op, nil
+	}
+	return *op, &f
+}
+
+// list returns all running operations and succeeded operations in their cooldown
+func (t *scaleUpTracker) list() []ScaleUp {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for target, last := range t.targets {
+		if !t.isActiveTarget(last) {
+			delete(t.targets, target)
+		}
+	}
+	operations := make([]ScaleUp, 0, len(t.operations))
+	for route, op := range t.operations {
+		if !t.isActive(op) {
+			delete(t.operations, route)
+			continue
+		}
+		operations = append(operations, *op)
+	}
+	return operations
+}
+
+// isActive returns true for running operations and succeeded operations in their cooldown, failed operations can be retried right away
+func (t *scaleUpTracker) isActive(op *ScaleUp) bool {
+	if op.Finished == nil {
+		return true
+	}
+	return op.Status == scaleUpSucceeded && time.Since(*op.Finished) < t.cooldown
+}
+
+func (t *scaleUpTracker) isActiveTarget(last *targetScaleUp) bool {
+	if last.finished == nil {
+		return true
+	}
+	return !last.failed && time.Since(*last.finished) < t.cooldown
+}
+
+// runScaleUp runs the scale-up operation of the route, it is started by the first poke of the route
+func (c *RequestBufferController) runScaleUp(r *route, op ScaleUp, dem demand) {
+	c.routeEvent(r, corev1.EventTypeNormal, reasonScaleUpStarted, "Scaling up the backends for %d pending requests", dem.pending)
+	c.setScalingUpCondition(r, op)
+
+	scaled, err := c.triggerScaleUp(r, dem)
+	if err != nil {
+		log.Printf("Failed to trigger scale-up of %s: %v", r, err)
+		c.routeEvent(r, corev1.EventTypeWarning, reasonScaleUpFailed, "Failed to scale up the backends: %v", err)
+	} else {
+		c.routeEvent(r, corev1.EventTypeNormal, reasonScaleUpSucceeded, "Scaled up %v", scaled)
+	}
+	op, f := c.scaleUps.finish(r.key(), scaled, err)
+	c.setScalingUpCondition(r, op)
+
+	// pokes with a higher demand joined the operation, e.g. the rest of a burst after the first buffered request
+	if f != nil && err == nil {
+		if op, started := c.scaleUps.start(r.key(), f.demand, f.replicas); started {
+			c.runScaleUp(r, op, f.demand)
+		}
+	}
+}
+
+// setScalingUpCondition reports the scale-up operation in the status of the route. Failures are only logged,
+// the condition is informational and the next scale-up sets it again.
+func (c *RequestBufferController) setScalingUpCondition(r *route, op ScaleUp) {
+	if err := c.setRouteCondition(r, scalingUpStatus(r, op)); err != nil {
+		log.Printf("Failed to set %s condition of %s: %v", scalingUpCondition, r, err)
+	}
+}
+
+// getScaleUps returns all running scale-up operations and the ones in their cooldown
+func (c *RequestBufferController) getScaleUps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonStr, err := json.Marshal(c.scaleUps.list())
+	if err != nil {
+		log.Println("failed to marshal scale-ups, err: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(jsonStr)
+	if err != nil {
+		log.Printf("failed to write to output stream, err: %v\n", err)
+	}
+}
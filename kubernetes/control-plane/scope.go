@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	gwinformers "sigs.k8s.io/gateway-api/pkg/client/informers/externalversions"
+)
+
+// routeInformerFactories create the informers of the route sources. Other than the factories of the controller,
+// they only list routes matching the --route-selector.
+type routeInformerFactories struct {
+	k8s     informers.SharedInformerFactory
+	gw      gwinformers.SharedInformerFactory
+	dynamic dynamicinformer.DynamicSharedInformerFactory
+}
+
+func (f routeInformerFactories) Start(stopCh <-chan struct{}) {
+	f.k8s.Start(stopCh)
+	f.gw.Start(stopCh)
+	f.dynamic.Start(stopCh)
+}
+
+// informerNamespace returns the namespace the informers are limited to. Only a single namespace can be set on the
+// informer factories, with multiple namespaces all namespaces are watched and routes are filtered by isBufferedRoute.
+func informerNamespace(namespaces []string) string {
+	if len(namespaces) == 1 {
+		return namespaces[0]
+	}
+	return metav1.NamespaceAll
+}
+
+// isBufferedRoute returns true if the route is in one of the watched namespaces and did not opt out of buffering.
+// With --opt-in, routes need to opt in with the enabled annotation.
+func (c *RequestBufferController) isBufferedRoute(obj metav1.Object) bool {
+	if len(c.options.namespaces) > 0 && !slices.Contains(c.options.namespaces, obj.GetNamespace()) {
+		return false
+	}
+	switch obj.GetAnnotations()[enabledAnnotation] {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return !c.options.optIn
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// controllerName is the controllerName of our entries in status.parents of Gateway API routes.
+// We write our own entries, so the controllers of the Gateways do not drop our conditions.
+const controllerName gwapiv1.GatewayController = "request-buffer.io/control-plane"
+
+// Conditions in the status of Gateway API routes
+const (
+	// scaledToZeroCondition is true while requests of the route are buffered, because no backend has ready endpoints
+	scaledToZeroCondition = "request-buffer.io/ScaledToZero"
+	// scalingUpCondition is true while a scale-up of the route is running, its reason reports the result of the last scale-up
+	scalingUpCondition = "request-buffer.io/ScalingUp"
+)
+
+// scaledToZeroStatus returns the ScaledToZero condition for the readiness of the route
+func scaledToZeroStatus(r *route, state RouteState) metav1.Condition {
+	if state.Ready {
+		return metav1.Condition{
+			Type:               scaledToZeroCondition,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: r.obj.GetGeneration(),
+			Reason:             "BackendsReady",
+			Message:            "Backends have enough ready endpoints, requests are not buffered",
+		}
+	}
+	return metav1.Condition{
+		Type:               scaledToZeroCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: r.obj.GetGeneration(),
+		Reason:             "NoReadyEndpoints",
+		Message:            "Backends do not have enough ready endpoints, requests are buffered",
+	}
+}
+
+// scalingUpStatus returns the ScalingUp condition for the scale-up operation of the route
+func scalingUpStatus(r *route, op ScaleUp) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               scalingUpCondition,
+		ObservedGeneration: r.obj.GetGeneration(),
+	}
+	switch op.Status {
+	case scaleUpRunning:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonScaleUpStarted
+		condition.Message = "Scaling up the backends of the route"
+	case scaleUpSucceeded:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonScaleUpSucceeded
+		condition.Message = fmt.Sprintf("Scaled up %v", op.Scaled)
+	default:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonScaleUpFailed
+		condition.Message = op.Error
+	}
+	return condition
+}
+
+// setRouteCondition sets the condition in our entries of status.parents of a Gateway API route.
+// Other route sources have no status for it. Only the leader writes the status.
+// The status is updated on the live route, as the lister can lag behind our own updates. The route from the lister is only
+// used to skip an unchanged ScaledToZero condition, which is set again on every reconcile, also once the lister caught up.
+// The ScalingUp condition is written twice in quick succession by a scale-up, so it is always compared to the live route.
+func (c *RequestBufferController) setRouteCondition(r *route, condition metav1.Condition) error {
+	if !c.isLeader() {
+		return nil
+	}
+	useCache := condition.Type == scaledToZeroCondition
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	namespace, name := r.obj.GetNamespace(), r.obj.GetName()
+	var err error
+	switch r.kind {
+	case httpRouteKind:
+		cached, getErr := c.routeInformers.gw.Gateway().V1().HTTPRoutes().Lister().HTTPRoutes(namespace).Get(name)
+		if getErr != nil {
+			err = getErr
+			break
+		}
+		if useCache && !setParentConditions(namespace, cached.Spec.CommonRouteSpec, &cached.DeepCopy().Status.RouteStatus, condition) {
+			return nil
+		}
+		client := c.gwClient.GatewayV1().HTTPRoutes(namespace)
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			rt, err := client.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !setParentConditions(namespace, rt.Spec.CommonRouteSpec, &rt.Status.RouteStatus, condition) {
+				return nil
+			}
+			_, err = client.UpdateStatus(ctx, rt, metav1.UpdateOptions{})
+			return err
+		})
+	case grpcRouteKind:
+		cached, getErr := c.routeInformers.gw.Gateway().V1alpha2().GRPCRoutes().Lister().GRPCRoutes(namespace).Get(name)
+		if getErr != nil {
+			err = getErr
+			break
+		}
+		if useCache && !setParentConditions(namespace, cached.Spec.CommonRouteSpec, &cached.DeepCopy().Status.RouteStatus, condition) {
+			return nil
+		}
+		client := c.gwClient.GatewayV1alpha2().GRPCRoutes(namespace)
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			rt, err := client.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !setParentConditions(namespace, rt.Spec.CommonRouteSpec, &rt.Status.RouteStatus, condition) {
+				return nil
+			}
+			_, err = client.UpdateStatus(ctx, rt, metav1.UpdateOptions{})
+			return err
+		})
+	}
+	if errors.IsNotFound(err) {
+		// the route was deleted in the meantime
+		return nil
+	}
+	return err
+}
+
+// setParentConditions sets the condition in our entry of every Gateway in the parentRefs and removes our entries of
+// parentRefs that were removed from the route. It returns true if the status changed.
+func setParentConditions(namespace string, spec gwapiv1.CommonRouteSpec, status *gwapiv1.RouteStatus, condition metav1.Condition) bool {
+	changed := false
+	isOurs := func(ps gwapiv1.RouteParentStatus, ref gwapiv1.ParentReference) bool {
+		return ps.ControllerName == controllerName && sameParentRef(namespace, ps.ParentRef, ref)
+	}
+
+	parents := make([]gwapiv1.RouteParentStatus, 0, len(status.Parents))
+	for _, ps := range status.Parents {
+		if ps.ControllerName == controllerName && !slices.ContainsFunc(spec.ParentRefs, func(ref gwapiv1.ParentReference) bool {
+			return isGatewayRef(ref) && isOurs(ps, ref)
+		}) {
+			changed = true
+			continue
+		}
+		parents = append(parents, ps)
+	}
+	for _, ref := range spec.ParentRefs {
+		if !isGatewayRef(ref) {
+			continue
+		}
+		i := slices.IndexFunc(parents, func(ps gwapiv1.RouteParentStatus) bool {
+			return isOurs(ps, ref)
+		})
+		if i < 0 {
+			parents = append(parents, gwapiv1.RouteParentStatus{ParentRef: ref, ControllerName: controllerName})
+			i = len(parents) - 1
+			changed = true
+		}
+		if meta.SetStatusCondition(&parents[i].Conditions, condition) {
+			changed = true
+		}
+	}
+	status.Parents = parents
+	return changed
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const virtualServiceKind = "VirtualService"
+
+// meshGateway is the reserved gateway name of Istio for the sidecars of the mesh
+const meshGateway = "mesh"
+
+// virtualServiceSpec is the part of the spec of an Istio VirtualService we need, to not depend on the Istio API
+type virtualServiceSpec struct {
+	Hosts    []string `json:"hosts"`
+	Gateways []string `json:"gateways"`
+	HTTP     []struct {
+		Route []struct {
+			Destination struct {
+				Host string `json:"host"`
+				Port *struct {
+					Number int32 `json:"number"`
+				} `json:"port"`
+			} `json:"destination"`
+			Weight *int32 `json:"weight"`
+		} `json:"route"`
+	} `json:"http"`
+}
+
+func (c *RequestBufferController) newVirtualServiceSource() (routeSource, error) {
+	mapping, err := c.restMapper.RESTMapping(schema.GroupKind{Group: "networking.istio.io", Kind: virtualServiceKind})
+	if err != nil {
+		return routeSource{}, err
+	}
+	return routeSource{
+		kind:     virtualServiceKind,
+		informer: c.routeInformers.dynamic.ForResource(mapping.Resource).Informer(),
+		toRoute:  c.virtualService,
+	}, nil
+}
+
+// virtualService resolves an Istio VirtualService. The destinations of the http routes are Services in the cluster,
+// given as short name, <name>.<namespace> or <name>.<namespace>.svc.cluster.local. Other destinations are ignored.
+func (c *RequestBufferController) virtualService(obj interface{}) (*route, bool) {
+	vs, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		log.Printf("object is not a VirtualService: %v", obj)
+		return nil, false
+	}
+
+	spec := virtualServiceSpec{}
+	raw, _, err := unstructured.NestedMap(vs.Object, "spec")
+	if err == nil {
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec)
+	}
+	if err != nil {
+		log.Printf("Invalid spec of %s: %v", routeKey(virtualServiceKind, vs), err)
+		return nil, false
+	}
+
+	r := &route{
+		kind:      virtualServiceKind,
+		obj:       vs,
+		hostnames: spec.Hosts,
+	}
+	for _, gw := range spec.Gateways {
+		if gw == meshGateway {
+			continue
+		}
+		if !strings.Contains(gw, "/") {
+			gw = vs.GetNamespace() + splitter + gw
+		}
+		r.gateways = append(r.gateways, gw)
+	}
+	if len(r.gateways) == 0 {
+		// without gateways, the VirtualService only applies to the sidecars of the mesh
+		return nil, false
+	}
+	for i, http := range spec.HTTP {
+		for _, dest := range http.Route {
+			namespace, name, ok := c.destinationService(vs.GetNamespace(), dest.Destination.Host)
+			if !ok {
+				continue
+			}
+			ref := serviceBackendRef{
+				rule:      i,
+				namespace: namespace,
+				name:      name,
+				weight:    1,
+			}
+			if dest.Destination.Port != nil {
+				port := gwapiv1.PortNumber(dest.Destination.Port.Number)
+				ref.port = &port
+			}
+			if dest.Weight != nil {
+				ref.weight = *dest.Weight
+			}
+			r.backends = append(r.backends, ref)
+		}
+	}
+	return r, true
+}
+
+// destinationService returns the namespace and name of the Service of the destination host, false for hosts outside the cluster.
+// Hosts are short names, <name>.<namespace>.svc with any cluster domain, or <name>.<namespace> if the Service exists,
+// as e.g. httpbin.org is a host outside the cluster.
+func (c *RequestBufferController) destinationService(namespace, host string) (string, string, bool) {
+	parts := strings.Split(host, ".")
+	switch {
+	case len(parts) == 1:
+		return namespace, parts[0], true
+	case len(parts) >= 3 && parts[2] == "svc":
+		return parts[1], parts[0], true
+	case len(parts) == 2:
+		_, err := c.serviceInformer.Lister().Services(parts[1]).Get(parts[0])
+		return parts[1], parts[0], err == nil
+	default:
+		return "", "", false
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/retocode/envoy-request-buffer/auth"
 )
 
 var scaledToZeroClusters = make(map[string]struct{})
@@ -13,8 +16,19 @@ var scaledToZeroClusters = make(map[string]struct{})
 const httpPort = 7001
 
 func main() {
-	http.HandleFunc("/", getScaledToZeroClusters)
-	http.HandleFunc("/set-scaled-to-zero", setScaledToZero)
+	authTokenFile := flag.String("auth-token-file", "", "(optional) path to a file containing the bearer token the wasm plugins have to send")
+	flag.Parse()
+
+	authToken, err := auth.ReadToken(*authTokenFile)
+	if err != nil {
+		log.Fatalf("Failed to read auth token: %v", err)
+	}
+	if authToken == "" {
+		log.Println("No auth token configured, the control-plane API is unauthenticated")
+	}
+
+	http.HandleFunc("/", auth.Authenticate(authToken, getScaledToZeroClusters))
+	http.HandleFunc("/set-scaled-to-zero", auth.Authenticate(authToken, setScaledToZero))
 	srv := &http.Server{
 		Addr:         ":" + strconv.Itoa(httpPort),
 		WriteTimeout: 5 * time.Second,
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
+	"net/url"
 	"slices"
+	"strconv"
 
 	"github.com/retocode/envoy-request-buffer/wasm-request-buffer/shared"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
 
-const hostHeaderKey = "host"
+const (
+	hostHeaderKey = "host"
+	pathHeaderKey = ":path"
+)
 
 const tickMilliseconds uint32 = 1000 // every second
 
@@ -20,7 +26,8 @@ type filterPluginContext struct {
 	types.DefaultPluginContext
 	contextID                uint32
 	config                   *shared.PluginConfig
-	pausedRequestsForCluster map[string][]uint32 // [host][[]httpContextIDs]
+	pausedRequestsForCluster map[string][]uint32 // [scaled to zero host][[]httpContextIDs]
+	requestCounts            map[string]int      // [host]requests since the last tick
 }
 
 type httpContext struct {
@@ -37,6 +44,7 @@ func (*filterVmContext) NewPluginContext(contextID uint32) types.PluginContext {
 	return &filterPluginContext{
 		contextID:                contextID,
 		pausedRequestsForCluster: make(map[string][]uint32),
+		requestCounts:            make(map[string]int),
 	}
 }
 
@@ -49,7 +57,7 @@ func (ctx *filterPluginContext) OnPluginStart(pluginConfigurationSize int) types
 
 	config, err := shared.ParseConfig(data)
 	if err != nil {
-		proxywasm.LogCriticalf("failed to parse plugin config: %s, err: %v", data, err)
+		proxywasm.LogCriticalf("failed to parse plugin config: %v", err)
 		return types.OnPluginStartStatusFailed
 	}
 	ctx.config = config
@@ -58,7 +66,7 @@ func (ctx *filterPluginContext) OnPluginStart(pluginConfigurationSize int) types
 		proxywasm.LogCriticalf("failed to set tick period: %v", err)
 	}
 
-	proxywasm.LogInfo("Filter plugin started with ticker")
+	proxywasm.LogInfof("Filter plugin started with ticker for instance: %q", config.InstanceID)
 
 	return types.OnPluginStartStatusOK
 }
@@ -71,7 +79,9 @@ func (ctx *filterPluginContext) NewHttpContext(contextID uint32) types.HttpConte
 }
 
 func (ctx *filterPluginContext) OnTick() {
-	scaledToZeroClusters, err := getScaledToZeroClusters()
+	ctx.flushRequestCounts()
+
+	scaledToZeroClusters, err := getScaledToZeroClusters(ctx.config)
 	if err != nil {
 		proxywasm.LogCriticalf("failed to get scaled to zero state: %v", err)
 		return
@@ -97,6 +107,10 @@ func (ctx *filterPluginContext) OnTick() {
 				}
 			}
 
+			if _, err := shared.AddToSharedCounter(ctx.config.HostKey(shared.PendingRequestsKey, host), -len(pendingHTTPContexts)); err != nil {
+				proxywasm.LogCriticalf("failed to update pending requests for host %s: %v", host, err)
+			}
+
 			proxywasm.LogDebugf("Removing %s from pausedRequestsForCluster", host)
 			delete(ctx.pausedRequestsForCluster, host)
 		}
@@ -110,48 +124,55 @@ func (ctx *httpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) t
 		return types.ActionContinue
 	}
 
+	// the path is only needed to match routes limited to gRPC services or methods
+	path, _ := proxywasm.GetHttpRequestHeader(pathHeaderKey)
+
+	// Count all requests for the activity reporting of the service plugin
+	ctx.pluginCtx.requestCounts[host]++
+
 	// Check on shared data if current target is scaled to zero
-	scaledToZeroClusters, err := getScaledToZeroClusters()
+	scaledToZeroClusters, err := getScaledToZeroClusters(ctx.pluginCtx.config)
 	if err != nil {
 		proxywasm.LogCriticalf("failed to get scaled to zero state: %v", err)
 		return types.ActionContinue
 	}
-	if slices.Contains(scaledToZeroClusters, host) {
-		proxywasm.LogDebugf("%s is scaled to zero, pausing http request with httpContextID: %d", host, ctx.httpContextID)
+	// requests are paused and counted per matching scaled to zero host, which can be a wildcard or limited to gRPC methods
+	if scaledToZeroHost, isScaledToZero := shared.MatchHost(scaledToZeroClusters, host, path); isScaledToZero {
+		proxywasm.LogDebugf("%s is scaled to zero, pausing http request with httpContextID: %d", scaledToZeroHost, ctx.httpContextID)
 
-		pendingRequests, has := ctx.pluginCtx.pausedRequestsForCluster[host]
+		pendingRequests, has := ctx.pluginCtx.pausedRequestsForCluster[scaledToZeroHost]
 		if has {
-			ctx.pluginCtx.pausedRequestsForCluster[host] = append(pendingRequests, ctx.httpContextID)
+			ctx.pluginCtx.pausedRequestsForCluster[scaledToZeroHost] = append(pendingRequests, ctx.httpContextID)
 		} else {
-			ctx.pluginCtx.pausedRequestsForCluster[host] = []uint32{ctx.httpContextID}
+			ctx.pluginCtx.pausedRequestsForCluster[scaledToZeroHost] = []uint32{ctx.httpContextID}
+		}
+
+		// Track the pending requests of all worker threads in the shared data
+		config := ctx.pluginCtx.config
+		pending, err := shared.AddToSharedCounter(config.HostKey(shared.PendingRequestsKey, scaledToZeroHost), 1)
+		if err != nil {
+			proxywasm.LogCriticalf("failed to update pending requests for host %s: %v", scaledToZeroHost, err)
+		}
+		if _, err := shared.AddToSharedCounter(config.HostKey(shared.ArrivedRequestsKey, scaledToZeroHost), 1); err != nil {
+			proxywasm.LogCriticalf("failed to update arrived requests for host %s: %v", scaledToZeroHost, err)
+		}
+		// the arrival rate is calculated by the service plugin
+		rate, _, err := proxywasm.GetSharedData(config.HostKey(shared.ArrivalRateKey, scaledToZeroHost))
+		if err != nil || len(rate) == 0 {
+			rate = []byte("0")
 		}
 
 		// TODO: we could optimize this
 		// 1) debounce it
 		// 2) do it from the shared service using a queue
-		proxywasm.LogDebugf("Poking scale-up for host: %s on http request with httpContextID: %d", host, ctx.httpContextID)
-		headers := [][2]string{
-			{":method", "POST"},
-			{":authority", ctx.pluginCtx.config.ControlPlaneURL},
-			{":path", "/poke-scale-up?host=" + host},
-			{"accept", "*/*"},
-		}
-
-		proxywasm.LogInfof("Calling out to %s with headers: %v", ctx.pluginCtx.config.ControlPlaneCluster, headers)
-
-		if _, err := proxywasm.DispatchHttpCall(ctx.pluginCtx.config.ControlPlaneCluster, headers, nil, nil,
-			5000, func(numHeaders, bodySize, numTrailers int) {
-				// we just log the response here
-				headers, err := proxywasm.GetHttpCallResponseHeaders()
-				if err != nil {
-					proxywasm.LogCriticalf("failed to get control-plane response headers: %v", err)
-					return
-				}
-
-				proxywasm.LogInfof("Received the following response headers from control-plane: %s", headers)
-			}); err != nil {
-			proxywasm.LogCriticalf("dispatch httpcall failed: %v", err)
-		}
+		proxywasm.LogDebugf("Poking scale-up for host: %s with %d pending requests on http request with httpContextID: %d", host, pending, ctx.httpContextID)
+		// the matched entry identifies the scaled to zero route, if multiple routes share the host
+		path := "/poke-scale-up?host=" + url.QueryEscape(host) + "&entry=" + url.QueryEscape(scaledToZeroHost) +
+			"&pending=" + strconv.Itoa(pending) + "&rate=" + string(rate)
+		shared.DispatchControlPlaneCall(config, "POST", path, nil, func(status string, bodySize int) {
+			// we just log the response here
+			proxywasm.LogInfof("Received status %s from control-plane for poking scale-up of host: %s", status, host)
+		})
 
 		return types.ActionPause
 	}
@@ -160,8 +181,35 @@ func (ctx *httpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) t
 	return types.ActionContinue
 }
 
-func getScaledToZeroClusters() ([]string, error) {
-	data, _, err := proxywasm.GetSharedData(shared.ScaledToZeroClustersKey)
+// flushRequestCounts adds the locally counted requests to the counters in the shared data.
+// We only do this on tick to not update the shared data on every request.
+func (ctx *filterPluginContext) flushRequestCounts() {
+	for host, count := range ctx.requestCounts {
+		err := shared.AddToSharedSet(ctx.config.InstanceKey(shared.KnownHostsKey), host, shared.MaxKnownHosts)
+		if errors.Is(err, shared.ErrSetFull) {
+			proxywasm.LogWarnf("too many known hosts, not counting requests for host %s", host)
+			delete(ctx.requestCounts, host)
+			continue
+		}
+		if err != nil {
+			proxywasm.LogCriticalf("failed to add host %s to known hosts: %v", host, err)
+			continue
+		}
+		if _, err := shared.AddToSharedCounter(ctx.config.HostKey(shared.RequestCountKey, host), count); err != nil {
+			proxywasm.LogCriticalf("failed to update request count for host %s: %v", host, err)
+			continue
+		}
+		delete(ctx.requestCounts, host)
+	}
+}
+
+// getScaledToZeroClusters only reads the state of the configured instance
+func getScaledToZeroClusters(config *shared.PluginConfig) ([]string, error) {
+	data, _, err := proxywasm.GetSharedData(config.InstanceKey(shared.ScaledToZeroClustersKey))
+	if errors.Is(err, types.ErrorStatusNotFound) {
+		// the service plugin of this instance did not yet initialize the state
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
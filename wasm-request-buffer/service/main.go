@@ -2,6 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/retocode/envoy-request-buffer/wasm-request-buffer/shared"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
@@ -10,6 +13,8 @@ import (
 
 const tickMilliseconds uint32 = 1000 * 2 // every 2 seconds
 
+const activityReportTicks = 5 // every 10 seconds
+
 type vmContext struct {
 	types.DefaultVMContext
 }
@@ -18,25 +23,23 @@ type servicePluginContext struct {
 	contextID uint32
 	config    *shared.PluginConfig
 	types.DefaultPluginContext
+	arrivedRequests map[string]int // [host]arrived requests at the last tick
+
+	ticks         int
+	requestCounts map[string]int   // [host]request count at the last activity report
+	lastSeen      map[string]int64 // [host]unix timestamp of the last request
 }
 
 func main() {
 	proxywasm.SetVMContext(&vmContext{})
 }
 
-func (*vmContext) OnVMStart(vmConfigurationSize int) types.OnVMStartStatus {
-	// Set the initial value of the shared data to an empty slice
-	b := shared.EncodeSharedData([]string{})
-	if err := proxywasm.SetSharedData(shared.ScaledToZeroClustersKey, b, 0); err != nil {
-		proxywasm.LogCriticalf("error setting shared data on OnVMStart: %v", err)
-		return types.OnVMStartStatusFailed
-	}
-	return types.OnVMStartStatusOK
-}
-
 func (*vmContext) NewPluginContext(contextID uint32) types.PluginContext {
 	return &servicePluginContext{
-		contextID: contextID,
+		contextID:       contextID,
+		arrivedRequests: make(map[string]int),
+		requestCounts:   make(map[string]int),
+		lastSeen:        make(map[string]int64),
 	}
 }
 
@@ -54,39 +57,50 @@ func (ctx *servicePluginContext) OnPluginStart(pluginConfigurationSize int) type
 
 	config, err := shared.ParseConfig(data)
 	if err != nil {
-		proxywasm.LogCriticalf("failed to parse plugin config: %s, err: %v", data, err)
+		proxywasm.LogCriticalf("failed to parse plugin config: %v", err)
 		return types.OnPluginStartStatusFailed
 	}
 	ctx.config = config
 
+	// Set the initial value of the shared data of this instance to an empty slice
+	b := shared.EncodeSharedData([]string{})
+	if err := proxywasm.SetSharedData(config.InstanceKey(shared.ScaledToZeroClustersKey), b, 0); err != nil {
+		proxywasm.LogCriticalf("error setting shared data on OnPluginStart: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+
 	// Start a ticker to get status from control-plane
 	if err := proxywasm.SetTickPeriodMilliSeconds(tickMilliseconds); err != nil {
 		proxywasm.LogCriticalf("failed to set tick period: %v", err)
 		return types.OnPluginStartStatusFailed
 	}
 
-	proxywasm.LogInfo("Service plugin started with ticker")
+	proxywasm.LogInfof("Service plugin started with ticker for instance: %q", config.InstanceID)
 	return types.OnPluginStartStatusOK
 }
 
 func (ctx *servicePluginContext) OnTick() {
-	// Call our control plane to get the new list of scaled to zero clusters
-	headers := [][2]string{
-		{":method", "GET"},
-		{":authority", ctx.config.ControlPlaneURL},
-		{":path", "/"},
-		{"accept", "*/*"},
-	}
+	ctx.updateArrivalRates()
 
-	proxywasm.LogInfof("calling out to %s with headers: %v", ctx.config.ControlPlaneCluster, headers)
+	ctx.ticks++
+	if ctx.ticks%activityReportTicks == 0 {
+		ctx.reportActivity()
+	}
 
-	if _, err := proxywasm.DispatchHttpCall(ctx.config.ControlPlaneCluster, headers, nil, nil,
-		5000, ctx.controlPlaneResponseCallback); err != nil {
-		proxywasm.LogCriticalf("dispatch httpcall failed: %v", err)
+	// Call our control plane to get the new list of scaled to zero clusters
+	path := "/"
+	if ctx.config.Gateway != "" {
+		path += "?gateway=" + ctx.config.Gateway
 	}
+	shared.DispatchControlPlaneCall(ctx.config, "GET", path, nil, ctx.controlPlaneResponseCallback)
 }
 
-func (ctx *servicePluginContext) controlPlaneResponseCallback(numHeaders, bodySize, numTrailers int) {
+func (ctx *servicePluginContext) controlPlaneResponseCallback(status string, bodySize int) {
+	if status != "200" {
+		proxywasm.LogCriticalf("control-plane responded with status: %s", status)
+		return
+	}
+
 	b, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
 	if err != nil {
 		proxywasm.LogCriticalf("failed to get control-plane response body: %v", err)
@@ -105,8 +119,105 @@ func (ctx *servicePluginContext) controlPlaneResponseCallback(numHeaders, bodySi
 	// 1) update the shared state with all currently scaled to zero clusters
 	proxywasm.LogInfof("Persisting %d paused clusters to the shared state", len(currentScaledToZeroClusters))
 	clustersEncoded := shared.EncodeSharedData(currentScaledToZeroClusters)
-	if err := proxywasm.SetSharedData(shared.ScaledToZeroClustersKey, clustersEncoded, 0); err != nil {
+	if err := proxywasm.SetSharedData(ctx.config.InstanceKey(shared.ScaledToZeroClustersKey), clustersEncoded, 0); err != nil {
 		proxywasm.LogCriticalf("error setting shared data: %v", err)
 		return
 	}
 }
+
+// updateArrivalRates calculates the arrival rate (requests per second) of requests buffered by the filters
+// for all scaled to zero hosts. The filters send the rate to the control-plane when poking a scale-up.
+func (ctx *servicePluginContext) updateArrivalRates() {
+	data, _, err := proxywasm.GetSharedData(ctx.config.InstanceKey(shared.ScaledToZeroClustersKey))
+	if err != nil {
+		proxywasm.LogCriticalf("failed to get scaled to zero state: %v", err)
+		return
+	}
+
+	arrivedRequests := make(map[string]int)
+	for _, host := range shared.GetSharedSet(data) {
+		arrived, err := shared.GetSharedCounter(ctx.config.HostKey(shared.ArrivedRequestsKey, host))
+		if err != nil {
+			proxywasm.LogCriticalf("failed to get arrived requests for host %s: %v", host, err)
+			continue
+		}
+		arrivedRequests[host] = arrived
+
+		last, has := ctx.arrivedRequests[host]
+		if !has || arrived < last {
+			continue
+		}
+		rate := float64(arrived-last) / (float64(tickMilliseconds) / 1000)
+		if err := proxywasm.SetSharedData(ctx.config.HostKey(shared.ArrivalRateKey, host), []byte(strconv.FormatFloat(rate, 'f', 2, 64)), 0); err != nil {
+			proxywasm.LogCriticalf("error setting arrival rate for host %s: %v", host, err)
+		}
+	}
+	ctx.arrivedRequests = arrivedRequests
+}
+
+// reportActivity sends the number of requests per host since the last report
+// and the time a host last received a request to the control-plane.
+func (ctx *servicePluginContext) reportActivity() {
+	data, _, err := proxywasm.GetSharedData(ctx.config.InstanceKey(shared.KnownHostsKey))
+	if err != nil {
+		// no requests yet
+		return
+	}
+
+	now := time.Now().Unix()
+	// Note: tinygo does not support json.Marshal well, so we build the body ourselves
+	var entries []string
+	// hosts without requests since their last report are evicted, the control-plane already knows when they were last seen
+	var idle []string
+	for _, host := range shared.GetSharedSet(data) {
+		count, err := shared.GetSharedCounter(ctx.config.HostKey(shared.RequestCountKey, host))
+		if err != nil {
+			proxywasm.LogCriticalf("failed to get request count for host %s: %v", host, err)
+			continue
+		}
+		requests := count - ctx.requestCounts[host]
+		if requests < 0 {
+			requests = count
+		}
+		ctx.requestCounts[host] = count
+		if requests == 0 {
+			idle = append(idle, host)
+			continue
+		}
+		ctx.lastSeen[host] = now
+
+		entries = append(entries, `{"host":`+strconv.Quote(host)+
+			`,"requests":`+strconv.Itoa(requests)+
+			`,"last-seen":`+strconv.FormatInt(ctx.lastSeen[host], 10)+`}`)
+	}
+	ctx.evictHosts(idle)
+	if len(entries) == 0 {
+		return
+	}
+
+	body := []byte("[" + strings.Join(entries, ",") + "]")
+	shared.DispatchControlPlaneCall(ctx.config, "POST", "/v1/activity", body, func(status string, bodySize int) {
+		if status != "200" {
+			proxywasm.LogWarnf("control-plane responded to activity report with status: %s", status)
+		}
+	})
+}
+
+// evictHosts removes idle hosts from the known hosts. Their request counters are reset by the requests that were
+// already reported, so requests counted by the filter in the meantime are reported once the host is known again.
+func (ctx *servicePluginContext) evictHosts(hosts []string) {
+	if len(hosts) == 0 {
+		return
+	}
+	if err := shared.RemoveFromSharedSet(ctx.config.InstanceKey(shared.KnownHostsKey), hosts); err != nil {
+		proxywasm.LogCriticalf("failed to evict idle hosts from known hosts: %v", err)
+		return
+	}
+	for _, host := range hosts {
+		if _, err := shared.AddToSharedCounter(ctx.config.HostKey(shared.RequestCountKey, host), -ctx.requestCounts[host]); err != nil {
+			proxywasm.LogCriticalf("failed to reset request count for host %s: %v", host, err)
+		}
+		delete(ctx.requestCounts, host)
+		delete(ctx.lastSeen, host)
+	}
+}
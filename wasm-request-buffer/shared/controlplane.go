@@ -0,0 +1,92 @@
+package shared
+
+import (
+	"strconv"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+const controlPlaneTimeoutMilliseconds uint32 = 5000
+
+// ControlPlaneCallback is called with the response status and body size of a successful control-plane call
+type ControlPlaneCallback func(status string, bodySize int)
+
+// DispatchControlPlaneCall calls the currently active control-plane endpoint.
+// On dispatch errors, timeouts or 5xx responses, the next endpoint in the list is tried
+// and recorded as the active endpoint once it responds.
+func DispatchControlPlaneCall(pc *PluginConfig, method, path string, body []byte, callback ControlPlaneCallback) {
+	dispatchWithFailover(pc, method, path, body, getActiveControlPlane(pc), 0, callback)
+}
+
+func dispatchWithFailover(pc *PluginConfig, method, path string, body []byte, idx, attempt int, callback ControlPlaneCallback) {
+	if attempt >= len(pc.ControlPlaneEndpoints) {
+		proxywasm.LogCriticalf("all %d control-plane endpoints failed for %s %s", len(pc.ControlPlaneEndpoints), method, path)
+		return
+	}
+
+	endpoint := pc.ControlPlaneEndpoints[idx]
+	failover := func() {
+		dispatchWithFailover(pc, method, path, body, (idx+1)%len(pc.ControlPlaneEndpoints), attempt+1, callback)
+	}
+
+	// headers are not logged, as they might contain the control-plane token
+	proxywasm.LogDebugf("calling out to control-plane %s: %s %s", endpoint.Cluster, method, path)
+
+	_, err := proxywasm.DispatchHttpCall(endpoint.Cluster, pc.ControlPlaneHeaders(endpoint, method, path), body, nil,
+		controlPlaneTimeoutMilliseconds, func(numHeaders, bodySize, numTrailers int) {
+			// on timeout or connection failure, envoy calls us without any response headers
+			headers, err := proxywasm.GetHttpCallResponseHeaders()
+			if err != nil || numHeaders == 0 {
+				proxywasm.LogWarnf("control-plane %s did not respond, failing over: %v", endpoint.Cluster, err)
+				failover()
+				return
+			}
+			status := GetStatus(headers)
+			if status == "" || status[0] == '5' {
+				proxywasm.LogWarnf("control-plane %s responded with status: %s, failing over", endpoint.Cluster, status)
+				failover()
+				return
+			}
+
+			setActiveControlPlane(pc, idx)
+			callback(status, bodySize)
+		})
+	if err != nil {
+		proxywasm.LogWarnf("dispatch httpcall to control-plane %s failed, failing over: %v", endpoint.Cluster, err)
+		failover()
+	}
+}
+
+// GetStatus returns the value of the :status pseudo header
+func GetStatus(headers [][2]string) string {
+	for _, h := range headers {
+		if h[0] == ":status" {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+func getActiveControlPlane(pc *PluginConfig) int {
+	data, _, err := proxywasm.GetSharedData(pc.InstanceKey(ActiveControlPlaneKey))
+	if err != nil {
+		// not yet set, start with the first endpoint
+		return 0
+	}
+	idx, err := strconv.Atoi(string(data))
+	if err != nil || idx < 0 || idx >= len(pc.ControlPlaneEndpoints) {
+		return 0
+	}
+	return idx
+}
+
+func setActiveControlPlane(pc *PluginConfig, idx int) {
+	value := []byte(strconv.Itoa(idx))
+	if current, _, err := proxywasm.GetSharedData(pc.InstanceKey(ActiveControlPlaneKey)); err == nil && string(current) == string(value) {
+		return
+	}
+	proxywasm.LogInfof("switching active control-plane endpoint to index: %d", idx)
+	if err := proxywasm.SetSharedData(pc.InstanceKey(ActiveControlPlaneKey), value, 0); err != nil {
+		proxywasm.LogCriticalf("error setting active control-plane in shared data: %v", err)
+	}
+}
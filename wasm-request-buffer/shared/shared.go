@@ -2,12 +2,28 @@ package shared
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"os"
 	"strings"
 )
 
 const (
 	ScaledToZeroClustersKey = "scaled_to_zero_clusters_key"
-	splitter                = "~"
+	ActiveControlPlaneKey   = "active_control_plane_key"
+	PendingRequestsKey      = "pending_requests_key"
+	ArrivedRequestsKey      = "arrived_requests_key"
+	ArrivalRateKey          = "arrival_rate_key"
+	RequestCountKey         = "request_count_key"
+	KnownHostsKey           = "known_hosts_key"
+	// ReadyHostPrefix marks hostnames of ready routes published by the control-plane. They are only published
+	// if they are more specific than the hostname of a scaled to zero route, which must not buffer their requests.
+	ReadyHostPrefix = "!"
+	splitter        = "~"
+
+	// MaxKnownHosts limits the hosts counted for the activity reporting, as the Host header is chosen by clients.
+	// Hosts are evicted after their last requests were reported.
+	MaxKnownHosts = 1000
 )
 
 type RequestContext struct {
@@ -15,9 +31,31 @@ type RequestContext struct {
 	HttpContextID uint32
 }
 
+type ControlPlaneEndpoint struct {
+	Cluster   string `json:"cluster"`
+	Authority string `json:"authority"`
+}
+
 type PluginConfig struct {
-	ControlPlaneURL     string `json:"control-plane-url"`
-	ControlPlaneCluster string `json:"control-plane-cluster"`
+	// ControlPlaneURL and ControlPlaneCluster configure a single control-plane endpoint.
+	// Use ControlPlaneEndpoints to configure an ordered list of endpoints to fail over between.
+	ControlPlaneURL       string                 `json:"control-plane-url"`
+	ControlPlaneCluster   string                 `json:"control-plane-cluster"`
+	ControlPlaneEndpoints []ControlPlaneEndpoint `json:"control-plane-endpoints"`
+
+	// InstanceID isolates the shared data of multiple independently configured instances
+	// of the request buffer within the same Wasm VM (vm_id). Service and filter of one instance must use the same id.
+	InstanceID string `json:"instance-id"`
+
+	// ControlPlaneToken is the bearer token sent to the control-plane.
+	// Alternatively, ControlPlaneTokenEnv names an env variable of the Wasm VM holding the token,
+	// this way it can be loaded from a mounted secret file (see vm_config.environment_variables)
+	ControlPlaneToken    string `json:"control-plane-token"`
+	ControlPlaneTokenEnv string `json:"control-plane-token-env"`
+
+	// Gateway is the <namespace>/<name> of the Gateway this Envoy serves.
+	// If set, the control-plane only returns the scaled to zero hosts of routes attached to this Gateway.
+	Gateway string `json:"gateway"`
 }
 
 // Note:
@@ -31,11 +69,107 @@ func DecodeSharedData(data []byte) []string {
 	return strings.Split(str, splitter)
 }
 
+// MatchHost returns the entry of the hosts that matches the request and true, or false if none matches.
+// Hosts can be "*" to match all hosts, or have a leading wildcard label to match all hosts with the suffix,
+// e.g. *.example.com matches foo.example.com. Hosts limited to gRPC services or methods have them appended as path,
+// e.g. grpc.example.com/helloworld.Greeter/ matches all methods of the service, grpc.example.com/helloworld.Greeter/SayHello only one.
+// Like Envoy, only the entries of the most specific hostname are used, hostnames of ready routes (see ReadyHostPrefix)
+// shadow less specific scaled to zero hostnames, e.g. !foo.example.com shadows *.example.com and *.
+func MatchHost(hosts []string, host, path string) (string, bool) {
+	best, bestHostname := -1, ""
+	for _, h := range hosts {
+		hostname, _, _ := strings.Cut(strings.TrimPrefix(h, ReadyHostPrefix), "/")
+		if s := hostnameSpecificity(hostname); s > best && matchesHostname(hostname, host) {
+			best, bestHostname = s, hostname
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+
+	for _, h := range hosts {
+		hostname, prefix, hasPath := strings.Cut(h, "/")
+		if hostname != bestHostname {
+			continue
+		}
+		if !hasPath {
+			return h, true
+		}
+		prefix = "/" + prefix
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return h, true
+		}
+	}
+	return "", false
+}
+
+// hostnameSpecificity orders the hostnames matching a host: the exact hostname first,
+// then wildcard hostnames with the longest suffix and "*" last
+func hostnameSpecificity(hostname string) int {
+	if hostname == "*" {
+		return 0
+	}
+	if strings.HasPrefix(hostname, "*") {
+		return len(hostname)
+	}
+	return math.MaxInt32
+}
+
+func matchesHostname(hostname, host string) bool {
+	if hostname == "*" || hostname == host {
+		return true
+	}
+	suffix, isWildcard := strings.CutPrefix(hostname, "*")
+	return isWildcard && strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+}
+
 func ParseConfig(data []byte) (*PluginConfig, error) {
 	pc := &PluginConfig{}
 	err := json.Unmarshal(data, pc)
 	if err != nil {
 		return nil, err
 	}
+	if pc.ControlPlaneCluster != "" {
+		pc.ControlPlaneEndpoints = append([]ControlPlaneEndpoint{{
+			Cluster:   pc.ControlPlaneCluster,
+			Authority: pc.ControlPlaneURL,
+		}}, pc.ControlPlaneEndpoints...)
+	}
+	if len(pc.ControlPlaneEndpoints) == 0 {
+		return nil, fmt.Errorf("no control-plane endpoint configured")
+	}
+	if pc.ControlPlaneTokenEnv != "" {
+		pc.ControlPlaneToken = os.Getenv(pc.ControlPlaneTokenEnv)
+		if pc.ControlPlaneToken == "" {
+			return nil, fmt.Errorf("env variable %s for the control-plane token is empty", pc.ControlPlaneTokenEnv)
+		}
+	}
 	return pc, nil
 }
+
+// InstanceKey derives the name of a shared data key or queue for the configured instance
+func (pc *PluginConfig) InstanceKey(name string) string {
+	if pc.InstanceID == "" {
+		return name
+	}
+	return name + "/" + pc.InstanceID
+}
+
+// HostKey derives the name of a per-host shared data key for the configured instance
+func (pc *PluginConfig) HostKey(name, host string) string {
+	return pc.InstanceKey(name + "/" + host)
+}
+
+// ControlPlaneHeaders returns the http headers for a call to the control-plane, including authentication if configured
+func (pc *PluginConfig) ControlPlaneHeaders(endpoint ControlPlaneEndpoint, method, path string) [][2]string {
+	headers := [][2]string{
+		{":method", method},
+		{":authority", endpoint.Authority},
+		{":path", path},
+		{"accept", "*/*"},
+	}
+	if pc.ControlPlaneToken != "" {
+		headers = append(headers, [2]string{"authorization", "Bearer " + pc.ControlPlaneToken})
+	}
+	return headers
+}
@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+const maxCasRetries = 10
+
+// ErrSetFull is returned when a value is added to a shared set that reached its limit
+var ErrSetFull = errors.New("shared set is full")
+
+// AddToSharedCounter adds delta to the counter in the shared data and returns the new value.
+// The shared data is used by all worker threads, so we use CAS to not lose concurrent updates.
+func AddToSharedCounter(key string, delta int) (int, error) {
+	for i := 0; i < maxCasRetries; i++ {
+		current, cas, err := getSharedCounter(key)
+		if err != nil {
+			return 0, err
+		}
+
+		value := current + delta
+		if value < 0 {
+			value = 0
+		}
+		err = proxywasm.SetSharedData(key, []byte(strconv.Itoa(value)), cas)
+		if errors.Is(err, types.ErrorStatusCasMismatch) {
+			continue
+		}
+		return value, err
+	}
+	return 0, fmt.Errorf("failed to update counter %s after %d retries", key, maxCasRetries)
+}
+
+// GetSharedCounter returns the value of the counter in the shared data, 0 if it does not exist yet
+func GetSharedCounter(key string) (int, error) {
+	value, _, err := getSharedCounter(key)
+	return value, err
+}
+
+func getSharedCounter(key string) (int, uint32, error) {
+	data, cas, err := proxywasm.GetSharedData(key)
+	if errors.Is(err, types.ErrorStatusNotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(data) == 0 {
+		return 0, cas, nil
+	}
+	value, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid counter value in %s: %w", key, err)
+	}
+	return value, cas, nil
+}
+
+// AddToSharedSet adds value to the set in the shared data, if it is not yet part of it.
+// If the set already has limit values, ErrSetFull is returned.
+func AddToSharedSet(key string, value string, limit int) error {
+	for i := 0; i < maxCasRetries; i++ {
+		data, cas, err := proxywasm.GetSharedData(key)
+		if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+			return err
+		}
+
+		values := GetSharedSet(data)
+		if slices.Contains(values, value) {
+			return nil
+		}
+		if len(values) >= limit {
+			return ErrSetFull
+		}
+		err = proxywasm.SetSharedData(key, EncodeSharedData(append(values, value)), cas)
+		if errors.Is(err, types.ErrorStatusCasMismatch) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("failed to update set %s after %d retries", key, maxCasRetries)
+}
+
+// RemoveFromSharedSet removes the values from the set in the shared data
+func RemoveFromSharedSet(key string, remove []string) error {
+	for i := 0; i < maxCasRetries; i++ {
+		data, cas, err := proxywasm.GetSharedData(key)
+		if errors.Is(err, types.ErrorStatusNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		values := slices.DeleteFunc(GetSharedSet(data), func(v string) bool {
+			return slices.Contains(remove, v)
+		})
+		err = proxywasm.SetSharedData(key, EncodeSharedData(values), cas)
+		if errors.Is(err, types.ErrorStatusCasMismatch) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("failed to update set %s after %d retries", key, maxCasRetries)
+}
+
+// GetSharedSet decodes a set from the shared data, ignoring empty values
+func GetSharedSet(data []byte) []string {
+	var values []string
+	for _, v := range DecodeSharedData(data) {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}